@@ -4,13 +4,79 @@
 package goapi
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/mattia-cabrini/go-utility"
 )
 
 var chronoSerMutex = &sync.Mutex{}
 
+var dumpIntervalLock = &sync.RWMutex{}
+var dumpInterval = 1 * time.Second
+
+// SetDumpInterval sets how often Run dumps the sessions in the background;
+// a dump is skipped if no session was created or changed since the previous
+// one. With d == 0 no background dump happens and sessions are only dumped on
+// shutdown, unconditionally. It must be called before Run.
+func SetDumpInterval(d time.Duration) {
+	defer utility.Monitor(dumpIntervalLock)()
+	dumpInterval = d
+}
+
+func getDumpInterval() time.Duration {
+	defer utility.RMonitor(dumpIntervalLock)()
+	return dumpInterval
+}
+
+var writeThroughLock = &sync.RWMutex{}
+var writeThroughEnabled = false
+var writeThroughPath = ""
+
+// SetWriteThrough sets whether every change to a session is persisted at
+// once, by dumping the sessions, instead of waiting for the periodic dump.
+// No change is lost on a crash, at the cost of a full dump per write: enable
+// it only if sessions change rarely compared to how much they matter.
+// It has no effect unless Run is given a session dump path.
+func SetWriteThrough(enabled bool) {
+	defer utility.Monitor(writeThroughLock)()
+	writeThroughEnabled = enabled
+}
+
+// setWriteThroughPath tells write-through where the sessions are dumped.
+func setWriteThroughPath(path string) {
+	defer utility.Monitor(writeThroughLock)()
+	writeThroughPath = path
+}
+
+// writeThrough marks the sessions as changed and dumps them if write-through
+// is enabled.
+// Session methods defer it before taking their locks, so that it runs after
+// releasing them.
+func writeThrough() {
+	markSessionsDirty()
+
+	if path := getWriteThroughPath(); path != "" {
+		chronoSerialize(path)
+	}
+}
+
+// getWriteThroughPath returns the dump path if write-through is enabled.
+func getWriteThroughPath() string {
+	defer utility.RMonitor(writeThroughLock)()
+
+	if writeThroughEnabled {
+		return writeThroughPath
+	}
+
+	return ""
+}
+
 func chronoSerialize(path string) {
 	defer utility.Monitor(chronoSerMutex)()
 
@@ -18,3 +84,78 @@ func chronoSerialize(path string) {
 		utility.Logf(utility.ERROR, "%v", err)
 	}
 }
+
+// chronoSerializeIfDirty dumps the sessions if they changed since the last dump.
+func chronoSerializeIfDirty(path string) {
+	if sessionsChanged() {
+		chronoSerialize(path)
+	}
+}
+
+var dumpKeyLock = &sync.RWMutex{}
+var dumpAEAD cipher.AEAD
+
+// SetDumpEncryptionKey makes SessionDump encrypt the dump with AES-GCM under
+// key, which must be 16, 24 or 32 bytes long; RestoreSessions decrypts it.
+// Plaintext dumps are still restored, so that encryption can be turned on for
+// an existing dump. A nil key disables encryption.
+func SetDumpEncryptionKey(key []byte) error {
+	var aead cipher.AEAD
+
+	if key != nil {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return utility.AppendError(err)
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return utility.AppendError(err)
+		}
+	}
+
+	defer utility.Monitor(dumpKeyLock)()
+	dumpAEAD = aead
+
+	return nil
+}
+
+func getDumpAEAD() cipher.AEAD {
+	defer utility.RMonitor(dumpKeyLock)()
+	return dumpAEAD
+}
+
+// sealDump encrypts a serialized dump, if a key is set, prepending the nonce.
+func sealDump(plain []byte) ([]byte, error) {
+	aead := getDumpAEAD()
+	if aead == nil {
+		return plain, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// openDump decrypts a dump sealed by sealDump. Plaintext JSON dumps are
+// returned as they are.
+func openDump(content []byte) ([]byte, error) {
+	aead := getDumpAEAD()
+	if aead == nil {
+		return content, nil
+	}
+
+	if len(content) >= aead.NonceSize() {
+		nonce, sealed := content[:aead.NonceSize()], content[aead.NonceSize():]
+		if plain, err := aead.Open(nil, nonce, sealed, nil); err == nil {
+			return plain, nil
+		}
+	}
+
+	if json.Valid(content) {
+		return content, nil
+	}
+
+	return nil, errors.New("message authentication failed")
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// CORSConfig describes which cross-origin requests are allowed.
+type CORSConfig struct {
+	AllowedOrigins   []string // exact origins, or "*" for any
+	AllowedMethods   []string // if empty, the requested method is allowed
+	AllowedHeaders   []string // if empty, the requested headers are allowed
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache a preflight
+}
+
+var corsLock = &sync.RWMutex{}
+var corsConfig *CORSConfig
+
+// SetCORSConfig enables CORS with cfg. Without it no CORS header is emitted.
+// With AllowCredentials the request origin is reflected even when "*" is
+// allowed, since browsers refuse credentials with a wildcard origin.
+func SetCORSConfig(cfg CORSConfig) {
+	defer utility.Monitor(corsLock)()
+	corsConfig = &cfg
+}
+
+func getCORSConfig() *CORSConfig {
+	defer utility.RMonitor(corsLock)()
+	return corsConfig
+}
+
+// handleCORS adds the CORS headers for the origin of r and answers preflight
+// requests. It reports whether r was a preflight, in which case nothing else
+// must be written.
+func handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	cfg := getCORSConfig()
+	origin := r.Header.Get("Origin")
+
+	if cfg == nil || origin == "" {
+		return false
+	}
+
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	wildcard := slices.Contains(cfg.AllowedOrigins, "*")
+
+	if !wildcard && !slices.Contains(cfg.AllowedOrigins, origin) {
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return preflight
+	}
+
+	if wildcard && !cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		return false
+	}
+
+	if len(cfg.AllowedMethods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+	} else {
+		h.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+	}
+
+	if len(cfg.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+	} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+
+	if cfg.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// CSRFConfig configures the double-submit cookie CSRF protection.
+type CSRFConfig struct {
+	CookieName string // defaults to "csrftoken"
+	HeaderName string // defaults to "X-CSRF-Token"
+}
+
+var csrfLock = &sync.RWMutex{}
+var csrfConfig *CSRFConfig
+
+// SetCSRFConfig enables the double-submit cookie CSRF protection: a CSRF
+// cookie readable by scripts is set on every client, and requests with
+// methods other than GET, HEAD, OPTIONS and TRACE are refused with 403
+// unless they echo its value in the CSRF header. It complements the SameSite
+// attribute of the session cookie.
+func SetCSRFConfig(cfg CSRFConfig) {
+	defer utility.Monitor(csrfLock)()
+
+	if cfg.CookieName == "" {
+		cfg.CookieName = "csrftoken"
+	}
+
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = "X-CSRF-Token"
+	}
+
+	csrfConfig = &cfg
+}
+
+func getCSRFConfig() *CSRFConfig {
+	defer utility.RMonitor(csrfLock)()
+	return csrfConfig
+}
+
+// checkCSRF sets the CSRF cookie if the client has none and reports whether
+// r carries a valid token, or does not need one.
+func checkCSRF(w http.ResponseWriter, r *http.Request) (bool, error) {
+	cfg := getCSRFConfig()
+	if cfg == nil {
+		return true, nil
+	}
+
+	c, err := r.Cookie(cfg.CookieName)
+
+	if err != nil || c.Value == "" {
+		token, err := utility.RandString(32)
+		if err != nil {
+			return false, utility.AppendError(err)
+		}
+
+		sc := getCookieConfig()
+		http.SetCookie(w, &http.Cookie{
+			Name:     cfg.CookieName,
+			Value:    token,
+			Domain:   sc.Domain,
+			Path:     sc.Path,
+			Secure:   sc.Secure,
+			HttpOnly: false, // the client must read it to echo it
+			SameSite: sc.SameSite,
+		})
+
+		c = nil
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true, nil
+	}
+
+	header := r.Header.Get(cfg.HeaderName)
+
+	return c != nil && header != "" && subtle.ConstantTimeCompare([]byte(c.Value), []byte(header)) == 1, nil
+}
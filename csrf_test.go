@@ -0,0 +1,72 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+type csrfController struct{}
+
+func (csrfController) SavePost(s *Session) string {
+	return "saved"
+}
+
+func (csrfController) FormGet(s *Session) string {
+	return "form"
+}
+
+type csrfRoot struct {
+	Api csrfController `controller:"true" public:"true"`
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	SetCSRFConfig(CSRFConfig{})
+	t.Cleanup(func() {
+		defer utility.Monitor(csrfLock)()
+		csrfConfig = nil
+	})
+
+	// A first visit hands out the token
+	w := serve(csrfRoot{}, httptest.NewRequest(http.MethodGet, "/Api/Form", nil))
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "csrftoken" {
+			token = c.Value
+		}
+	}
+	if w.Code != http.StatusOK || token == "" {
+		t.Fatalf("GET: got %d, CSRF cookie %q", w.Code, token)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		header string
+		status int
+	}{
+		{"valid", token, token, http.StatusOK},
+		{"missing header", token, "", http.StatusForbidden},
+		{"mismatched header", token, token + "x", http.StatusForbidden},
+		{"missing cookie", "", token, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/Api/Save", nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "csrftoken", Value: tt.cookie})
+		}
+		if tt.header != "" {
+			r.Header.Set("X-CSRF-Token", tt.header)
+		}
+
+		if w := serve(csrfRoot{}, r); w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// StatusCoder is implemented by errors that know which HTTP status they map to.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// errorStatus maps err to an HTTP status code.
+// Errors implementing StatusCoder provide their own, a few well known
+// sentinels are mapped here, anything else is a 500.
+func errorStatus(err error) int {
+	var sc StatusCoder
+	var mbe *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &sc):
+		return sc.StatusCode()
+	case errors.As(err, &mbe):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, ErrEmptyBody), errors.Is(err, ErrTooManyParams):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+var errorHandlersLock = &sync.RWMutex{}
+var notFoundHandler func(w http.ResponseWriter, r *http.Request)
+var errorHandlers = make(map[int]func(w http.ResponseWriter, r *http.Request))
+
+// SetNotFoundHandler sets the handler writing 404 responses, both for
+// unknown static files and unknown requests. It takes precedence over a
+// handler set with SetErrorHandler(http.StatusNotFound, ...).
+// A nil fn restores the default.
+func SetNotFoundHandler(fn func(w http.ResponseWriter, r *http.Request)) {
+	defer utility.Monitor(errorHandlersLock)()
+	notFoundHandler = fn
+}
+
+// SetErrorHandler sets the handler writing responses with the given error
+// status. The handler must write the status itself.
+// A nil fn restores the default: a JSON body for 404 and 5xx statuses (see
+// WithNotFoundHandler and WithErrorHandler), a bare status otherwise.
+func SetErrorHandler(status int, fn func(w http.ResponseWriter, r *http.Request)) {
+	defer utility.Monitor(errorHandlersLock)()
+
+	if fn == nil {
+		delete(errorHandlers, status)
+	} else {
+		errorHandlers[status] = fn
+	}
+}
+
+func getErrorHandler(status int) func(w http.ResponseWriter, r *http.Request) {
+	defer utility.RMonitor(errorHandlersLock)()
+
+	if status == http.StatusNotFound && notFoundHandler != nil {
+		return notFoundHandler
+	}
+
+	return errorHandlers[status]
+}
+
+// writeStatus answers r with an error status, through the registered
+// handler if there is one.
+func writeStatus(w http.ResponseWriter, r *http.Request, status int) {
+	writeError(w, r, status, nil)
+}
+
+// writeError answers r with an error status caused by err, which may be nil.
+// A handler registered for status comes first; then 404 and 5xx statuses are
+// answered by the not found and error responders, other statuses are bare.
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h := getErrorHandler(status); h != nil {
+		h(w, r)
+		return
+	}
+
+	var resp Response
+
+	if status == http.StatusNotFound {
+		resp = getNotFoundResponder(r)()
+	} else if status >= 500 {
+		if err == nil {
+			err = errors.New(http.StatusText(status))
+		}
+		resp = getErrorResponder(r)(err)
+	}
+
+	if resp == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	// A response whose status was not set explicitly gets the error status
+	if sr, ok := resp.(statusResponse); ok && !sr.hasStatus() {
+		sr.SetStatus(status)
+	}
+
+	writeResponse(resp, w, r)
+}
+
+// responders holds the Server options answering failed requests. They are
+// attached to each request by withResponders, so that every Server keeps its
+// own; nil fields fall back to the defaults.
+type responders struct {
+	notFound func() Response
+	onError  func(err error) Response
+	panic    func(w http.ResponseWriter, r *http.Request, recovered interface{})
+}
+
+type respondersKey struct{}
+
+// withResponders makes rs available to the handling of every request h serves.
+func withResponders(h http.Handler, rs responders) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), respondersKey{}, rs)))
+	})
+}
+
+func getResponders(r *http.Request) responders {
+	rs, _ := r.Context().Value(respondersKey{}).(responders)
+	return rs
+}
+
+func getNotFoundResponder(r *http.Request) func() Response {
+	if fn := getResponders(r).notFound; fn != nil {
+		return fn
+	}
+
+	return defaultNotFoundResponse
+}
+
+func getErrorResponder(r *http.Request) func(err error) Response {
+	if fn := getResponders(r).onError; fn != nil {
+		return fn
+	}
+
+	return defaultErrorResponse
+}
+
+func defaultNotFoundResponse() Response {
+	jr := InitJsonResponse()
+	jr.SetStatus(http.StatusNotFound)
+	jr.AppendErrorStr("not found")
+	return jr
+}
+
+// defaultErrorResponse does not expose err to the client: it is logged by
+// the dispatcher already. Its status is left to writeError, so that e.g. a
+// 503 is not turned into a 500.
+func defaultErrorResponse(err error) Response {
+	jr := InitJsonResponse()
+	jr.AppendErrorStr("internal server error")
+	return jr
+}
+
+func getPanicHandler(r *http.Request) func(w http.ResponseWriter, r *http.Request, recovered interface{}) {
+	if fn := getResponders(r).panic; fn != nil {
+		return fn
+	}
+
+	return defaultPanicHandler
+}
+
+// defaultPanicHandler answers 500 Internal Server Error with a JSON body.
+func defaultPanicHandler(w http.ResponseWriter, r *http.Request, recovered interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {"internal server error"}})
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveWith dispatches req to root with the given per-Server responders.
+func serveWith(root interface{}, rs responders, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	withResponders(http.HandlerFunc(getHandler(root, "")), rs).ServeHTTP(w, req)
+	return w
+}
+
+func TestNotFoundResponderStatus(t *testing.T) {
+	spa := responders{notFound: func() Response {
+		hr := InitHTMLResponseString("<html>app</html>")
+		hr.SetStatus(http.StatusOK)
+		return hr
+	}}
+
+	w := serveWith(struct{}{}, spa, httptest.NewRequest(http.MethodGet, "/some/route", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "app") {
+		t.Errorf("explicit 200: got %d %q", w.Code, w.Body.String())
+	}
+
+	plain := responders{notFound: func() Response { return InitHTMLResponseString("<html>missing</html>") }}
+
+	w = serveWith(struct{}{}, plain, httptest.NewRequest(http.MethodGet, "/some/route", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("no status set: got %d, want 404", w.Code)
+	}
+}
+
+type failingController struct{}
+
+func (failingController) FailGet(s *Session) (string, error) {
+	return "", errors.New("boom")
+}
+
+func (failingController) PanicGet(s *Session) (string, error) {
+	panic("boom")
+}
+
+type failingRoot struct {
+	Api failingController `controller:"true" public:"true"`
+}
+
+func TestRespondersArePerServer(t *testing.T) {
+	a := responders{
+		notFound: func() Response { return InitPlainTextResponse("a: not found") },
+		onError:  func(err error) Response { return InitPlainTextResponse("a: " + err.Error()) },
+		panic: func(w http.ResponseWriter, r *http.Request, recovered interface{}) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("a: panic"))
+		},
+	}
+	b := responders{
+		notFound: func() Response { return InitPlainTextResponse("b: not found") },
+	}
+
+	tests := []struct {
+		rs     responders
+		path   string
+		status int
+		body   string
+	}{
+		{a, "/missing", http.StatusNotFound, "a: not found"},
+		{b, "/missing", http.StatusNotFound, "b: not found"},
+		{a, "/Api/Fail", http.StatusInternalServerError, "a: boom"},
+		{b, "/Api/Fail", http.StatusInternalServerError, "internal server error"},
+		{a, "/Api/Panic", http.StatusInternalServerError, "a: panic"},
+		{b, "/Api/Panic", http.StatusInternalServerError, "internal server error"},
+	}
+
+	for _, tt := range tests {
+		w := serveWith(failingRoot{}, tt.rs, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"compress/gzip"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Content types that are already compressed: gzipping them again costs CPU
+// for no gain.
+var defaultGzipSkipTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+// DefaultGzipSkipTypes returns the content type prefixes WithGzip sends
+// uncompressed by default, to be extended and passed to WithGzip.
+func DefaultGzipSkipTypes() []string {
+	return slices.Clone(defaultGzipSkipTypes)
+}
+
+// compressible reports whether a body of content type ct is worth gzipping,
+// that is whether it matches none of the prefixes in skip. SVG images are
+// text and always compressible.
+func compressible(ct string, skip []string) bool {
+	ct = strings.ToLower(ct)
+
+	if strings.HasPrefix(ct, "image/svg+xml") {
+		return true
+	}
+
+	for _, prefix := range skip {
+		if strings.HasPrefix(ct, strings.ToLower(prefix)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// acceptsGzip reports whether the Accept-Encoding header ae allows gzip,
+// honouring q-values: "gzip;q=0" refuses it, and "*" covers it unless gzip
+// is listed on its own.
+func acceptsGzip(ae string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+
+	for _, part := range strings.Split(ae, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				} else {
+					q = 0
+				}
+			}
+		}
+
+		switch coding {
+		case "gzip", "x-gzip":
+			gzipQ = max(gzipQ, q)
+		case "*":
+			anyQ = max(anyQ, q)
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+
+	return anyQ > 0
+}
+
+// withGzip compresses the responses of h for clients accepting gzip, when the
+// body is at least minSize bytes long and its content type matches none of
+// the prefixes in skip.
+func withGzip(h http.Handler, minSize int, skip []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, skip: skip, status: http.StatusOK}
+		defer gw.Close()
+
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter holds back the first minSize bytes of the body, so that
+// it can tell whether compressing is worth it before sending the headers.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	skip    []string // content type prefixes sent uncompressed
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if !gw.decided {
+		gw.status = status
+	}
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(p)
+		}
+		return gw.ResponseWriter.Write(p)
+	}
+
+	gw.buf = append(gw.buf, p...)
+	if len(gw.buf) >= gw.minSize {
+		if err := gw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// decide sends the headers, compressed or not, and the held back bytes.
+// large tells whether the body is known to reach minSize.
+func (gw *gzipResponseWriter) decide(large bool) error {
+	gw.decided = true
+
+	hdr := gw.Header()
+	hdr.Add("Vary", "Accept-Encoding")
+
+	if hdr.Get("Content-Type") == "" && len(gw.buf) > 0 {
+		hdr.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+
+	hasBody := gw.status >= 200 && gw.status != http.StatusNoContent &&
+		gw.status != http.StatusPartialContent && gw.status != http.StatusNotModified
+
+	if large && hasBody && hdr.Get("Content-Encoding") == "" &&
+		hdr.Get("Content-Range") == "" && compressible(hdr.Get("Content-Type"), gw.skip) {
+		hdr.Set("Content-Encoding", "gzip")
+		hdr.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	gw.ResponseWriter.WriteHeader(gw.status)
+
+	if len(gw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(gw.buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(gw.buf)
+	}
+	gw.buf = nil
+
+	return err
+}
+
+// Flush sends what is buffered: a response being flushed is a stream, which
+// is compressed regardless of its size so far.
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		gw.decide(true)
+	}
+
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// Close completes the response.
+func (gw *gzipResponseWriter) Close() error {
+	if !gw.decided {
+		gw.decide(false)
+	}
+
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+
+	return nil
+}
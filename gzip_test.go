@@ -0,0 +1,126 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gzipServe serves a body of content type ct through withGzip, for a client
+// sending the Accept-Encoding header ae.
+func gzipServe(ct string, body string, minSize int, skip []string, ae string) *httptest.ResponseRecorder {
+	h := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ct)
+		io.WriteString(w, body)
+	}), minSize, skip)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", ae)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestGzipCompressesJSON(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("a", 2048) + `"}`
+
+	rec := gzipServe("application/json", body, 1024, defaultGzipSkipTypes, "gzip, deflate")
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding %q, want gzip", ce)
+	}
+
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Error("decompressed body differs from the original")
+	}
+}
+
+func TestGzipSkipsUncompressed(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+
+	tests := []struct {
+		name string
+		ct   string
+		body string
+		skip []string
+		ae   string
+	}{
+		{"png", "image/png", large, defaultGzipSkipTypes, "gzip"},
+		{"below minSize", "application/json", `{"ok":true}`, defaultGzipSkipTypes, "gzip"},
+		{"gzip q=0", "application/json", large, defaultGzipSkipTypes, "gzip;q=0, deflate"},
+		{"any but gzip", "application/json", large, defaultGzipSkipTypes, "*, gzip;q=0"},
+		{"custom skip list", "application/wasm", large, []string{"application/wasm"}, "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := gzipServe(tt.ct, tt.body, 1024, tt.skip, tt.ae)
+			if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+				t.Errorf("Content-Encoding %q, want none", ce)
+			}
+			if rec.Body.String() != tt.body {
+				t.Error("body altered")
+			}
+		})
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"deflate, br":        false,
+		"GZIP;q=0.5":         true,
+		"gzip;q=0":           false,
+		"gzip; q=0.000":      false,
+		"*":                  true,
+		"*;q=0":              false,
+		"*;q=0, gzip":        true,
+		"x-gzip":             true,
+		"gzip;q=invalid, br": false,
+	}
+
+	for ae, want := range tests {
+		if got := acceptsGzip(ae); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", ae, got, want)
+		}
+	}
+}
+
+func TestGzipResponseController(t *testing.T) {
+	errs := make(chan error, 1)
+
+	srv := httptest.NewServer(withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errs <- http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+	}), 1024, defaultGzipSkipTypes))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if err := <-errs; err != nil {
+		t.Errorf("SetWriteDeadline through the gzip writer: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// Method name suffixes of the handlers dedicated to a single HTTP method.
+// A request named X is served by XGet, XPost, ... if present, and by
+// XRequest otherwise.
+var verbSuffixes = map[string]string{
+	http.MethodGet:    "Get",
+	http.MethodHead:   "Get",
+	http.MethodPost:   "Post",
+	http.MethodPut:    "Put",
+	http.MethodDelete: "Delete",
+}
+
+var handlerSuffixes = []string{"Request", "Get", "Post", "Put", "Delete"}
+
+// Methods in the order they are listed in Allow headers.
+var verbOrder = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+
+// resolveHandler looks up the handler of request for the HTTP method verb.
+// If there is none, allowed lists the methods request has handlers for, if
+// the resource exists at all.
+func resolveHandler(controller interface{}, request string, verb string) (name string, m *utility.Method, allowed []string) {
+	if suffix, ok := verbSuffixes[verb]; ok {
+		if m = handlerMethod(controller, request, suffix); m != nil {
+			return request + suffix, m, nil
+		}
+	}
+
+	if m = handlerMethod(controller, request, "Request"); m != nil {
+		return request + "Request", m, nil
+	}
+
+	for _, v := range verbOrder {
+		if handlerMethod(controller, request, verbSuffixes[v]) != nil {
+			allowed = append(allowed, v)
+		}
+	}
+
+	return "", nil, allowed
+}
+
+// handlerMethod returns the method request+suffix of controller, or nil if
+// there is none or its signature is not one the dispatcher can call: helper
+// methods that happen to end in a verb, such as CacheGet(), are not routed.
+func handlerMethod(controller interface{}, request string, suffix string) *utility.Method {
+	mv := reflect.ValueOf(controller).MethodByName(request + suffix)
+	if !mv.IsValid() || checkHandlerType(mv.Type()) != nil {
+		return nil
+	}
+
+	return utility.GetMethod(controller, request, suffix)
+}
+
+// propertyTag returns the value of tag on the property name of obj, or "".
+func propertyTag(obj interface{}, name string, tag string) string {
+	to := reflect.TypeOf(obj)
+
+	if to == nil || to.Kind() != reflect.Struct {
+		return ""
+	}
+
+	if f, ok := to.FieldByName(name); ok {
+		return f.Tag.Get(tag)
+	}
+
+	return ""
+}
+
+// sunsetDate formats the sunset tag of a deprecated controller as an HTTP
+// date. Tags in yyyy-mm-dd format are converted, anything else is kept as is.
+func sunsetDate(tag string) string {
+	if t, err := time.Parse("2006-01-02", tag); err == nil {
+		return t.Format(http.TimeFormat)
+	}
+	return tag
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var sessionType = reflect.TypeOf((*Session)(nil))
+var politeRequestType = reflect.TypeOf(PoliteRequest{})
+
+// checkHandlerType verifies that t (a method type, receiver excluded) is a
+// signature the dispatcher is able to call:
+//
+//	func(*Session) ...
+//	func(*Session, PoliteRequest) ...
+//
+// returning either a single payload, a payload and an error, or just an error.
+func checkHandlerType(t reflect.Type) error {
+	switch t.NumIn() {
+	case 2:
+		if !politeRequestType.AssignableTo(t.In(1)) {
+			return fmt.Errorf("second parameter must accept PoliteRequest, not %s", t.In(1))
+		}
+		fallthrough
+	case 1:
+		if !sessionType.AssignableTo(t.In(0)) {
+			return fmt.Errorf("first parameter must accept *Session, not %s", t.In(0))
+		}
+	default:
+		return fmt.Errorf("expected 1 or 2 parameters, got %d", t.NumIn())
+	}
+
+	switch t.NumOut() {
+	case 1:
+	case 2:
+		if t.Out(1) != errorType {
+			return fmt.Errorf("second return value must be error, not %s", t.Out(1))
+		}
+	default:
+		return fmt.Errorf("expected 1 or 2 return values, got %d", t.NumOut())
+	}
+
+	return nil
+}
+
+// isErrorOnlyHandler reports whether the handler method `name` of controller
+// returns nothing but an error.
+func isErrorOnlyHandler(controller interface{}, name string) bool {
+	mv := reflect.ValueOf(controller).MethodByName(name)
+	if !mv.IsValid() {
+		return false
+	}
+
+	t := mv.Type()
+	return t.NumOut() == 1 && t.Out(0) == errorType
+}
+
+// validateController walks controller and its sub-controllers checking the
+// params tags and the handler signatures. A ...Request method the dispatcher
+// cannot call is an error. Methods ending in a verb, such as CacheGet(), may
+// be helpers: if their signature is not a handler's they are only logged, as
+// they are not routed.
+func validateController(controller interface{}) error {
+	if controller == nil {
+		return nil
+	}
+
+	vo := reflect.ValueOf(controller)
+	to := vo.Type()
+
+	for i := 0; i < to.NumMethod(); i++ {
+		mt := to.Method(i)
+
+		for _, suffix := range handlerSuffixes {
+			if name, ok := strings.CutSuffix(mt.Name, suffix); ok && name != "" {
+				err := checkHandlerType(vo.Method(i).Type())
+				if err != nil && suffix == "Request" {
+					return fmt.Errorf("handler %s.%s: %v", to.Name(), mt.Name, err)
+				} else if err != nil {
+					utility.Logf(utility.WARNING, "%s.%s is not routed, not a handler: %v", to.Name(), mt.Name, err)
+				}
+				break
+			}
+		}
+	}
+
+	if to.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < to.NumField(); i++ {
+		ft := to.Field(i)
+
+		if ft.IsExported() && ft.Tag.Get("controller") == "true" {
+			if _, err := pathParamNames(ft.Tag.Get("params")); err != nil {
+				return fmt.Errorf("controller %s.%s: %v", to.Name(), ft.Name, err)
+			}
+			if err := validateController(vo.Field(i).Interface()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type controllerKey struct{}
+
+// ControllerFromContext returns the controller whose method is handling the
+// request ctx belongs to, or nil. Asserting its type is up to the caller.
+func ControllerFromContext(ctx context.Context) interface{} {
+	return ctx.Value(controllerKey{})
+}
+
+// routeConsumes returns the request content types accepted by the handlers
+// of request, or nil for any. They are declared by the consumes tag of a
+// marker field named after the route, e.g.:
+//
+//	SaveConsumes struct{} `consumes:"application/json"`
+func routeConsumes(controller interface{}, request string) []string {
+	tag := propertyTag(controller, request+"Consumes", "consumes")
+	if tag == "" {
+		return nil
+	}
+
+	types := strings.Split(tag, ",")
+	for i := range types {
+		types[i] = strings.ToLower(strings.TrimSpace(types[i]))
+	}
+
+	return types
+}
+
+// acceptsContentType reports whether the body of r, if any, has one of types
+// (either exact, or matching a "type/*" entry).
+func acceptsContentType(r *http.Request, types []string) bool {
+	if len(types) == 0 || (r.ContentLength == 0 && len(r.TransferEncoding) == 0) {
+		return true
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+type handlerTimeoutKey struct{}
+
+// withHandlerTimeout makes d the handler timeout of the requests h serves,
+// unless their route declares its own.
+func withHandlerTimeout(h http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), handlerTimeoutKey{}, d)))
+	})
+}
+
+// handlerTimeout returns the timeout of the handler answering r: the one
+// declared by its route, if any, or the one of the Server.
+func handlerTimeout(r *http.Request, rt route) time.Duration {
+	if rt.timeout != "" {
+		d, err := time.ParseDuration(rt.timeout)
+		if err == nil {
+			return d
+		}
+		utility.Logf(utility.WARNING, "invalid timeout %q for %s: %v", rt.timeout, r.URL.Path, err)
+	}
+
+	d, _ := r.Context().Value(handlerTimeoutKey{}).(time.Duration)
+	return d
+}
+
+// routeTimeout returns the timeout declared for the handlers of request by a
+// marker field, or "".
+func routeTimeout(controller interface{}, request string) string {
+	return propertyTag(controller, request+"Timeout", "timeout")
+}
+
+// handlerResult is the outcome of a handler run by callHandler.
+type handlerResult struct {
+	res       []interface{}
+	err       error
+	recovered interface{} // value of a panic of the handler, if any
+}
+
+// callHandler calls m with args in a goroutine of its own and waits for it at
+// most timeout. It reports false if the handler did not return in time, after
+// calling cancel; done then receives the outcome once the handler returns.
+// A panic of the handler is recovered and reported in the result.
+func callHandler(m *utility.Method, args []interface{}, timeout time.Duration, cancel context.CancelFunc) (hr handlerResult, done <-chan handlerResult, ok bool) {
+	ch := make(chan handlerResult, 1)
+
+	go func() {
+		var hr handlerResult
+
+		defer func() {
+			if i := recover(); i != nil {
+				if i != http.ErrAbortHandler {
+					utility.Logf(utility.ERROR, "%v\n%s", i, debug.Stack())
+				}
+				hr.recovered = i
+			}
+			ch <- hr
+		}()
+
+		hr.res, hr.err = m.F(args...)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case hr = <-ch:
+		return hr, ch, true
+	case <-timer.C:
+		cancel()
+		return hr, ch, false
+	}
+}
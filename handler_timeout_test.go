@@ -0,0 +1,85 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type slowController struct {
+	LongTimeout struct{} `timeout:"1s"`
+
+	canceled chan struct{}
+}
+
+func (c slowController) SlowGet(s *Session, pr PoliteRequest) (string, error) {
+	select {
+	case <-pr.Request.Context().Done():
+		close(c.canceled)
+	case <-time.After(time.Second):
+	}
+	return "late", nil
+}
+
+func (slowController) LongGet(s *Session) (string, error) {
+	time.Sleep(50 * time.Millisecond)
+	return "long", nil
+}
+
+func (slowController) StreamGet(s *Session, pr PoliteRequest) (Response, error) {
+	items := make(chan interface{})
+
+	go func() {
+		defer close(items)
+		for i := 0; i < 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			items <- i
+		}
+	}()
+
+	return InitNDJSONResponse(pr.Request.Context(), items), nil
+}
+
+type slowRoot struct {
+	Api slowController `controller:"true" public:"true"`
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	root := slowRoot{Api: slowController{canceled: make(chan struct{})}}
+	h := withHandlerTimeout(http.HandlerFunc(getHandler(root, "")), 20*time.Millisecond)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	start := time.Now()
+	if w := get("/Api/Slow"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("slow handler: status %d, want 503", w.Code)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("slow handler answered after %v", d)
+	}
+
+	select {
+	case <-root.Api.canceled:
+	case <-time.After(time.Second):
+		t.Error("slow handler: context not canceled")
+	}
+
+	if w := get("/Api/Long"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "long") {
+		t.Errorf("route timeout: got %d %q", w.Code, w.Body.String())
+	}
+
+	// The stream outlasts the timeout, but only the handler is bounded
+	w := get("/Api/Stream")
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 3 {
+		t.Errorf("stream: got %d %q, want 3 lines", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// HeaderLimits describes which request headers are rejected with 400 Bad
+// Request before dispatching. Zero values disable the respective check.
+//
+// There is no check against request smuggling through the framing headers:
+// net/http already answers 400 to conflicting Content-Length values, and
+// drops Content-Length when Transfer-Encoding is set, before the request
+// reaches any handler.
+type HeaderLimits struct {
+	MaxTotalSize int // bytes of all the header lines together
+	MaxValueSize int // bytes of a single header value
+}
+
+var headerLimitsLock = &sync.RWMutex{}
+var headerLimits HeaderLimits
+
+// SetHeaderLimits enables the checks of limits on every request. All checks
+// are disabled by default. Note that http.Server.MaxHeaderBytes still bounds
+// what is read from the connection in the first place.
+func SetHeaderLimits(limits HeaderLimits) {
+	defer utility.Monitor(headerLimitsLock)()
+	headerLimits = limits
+}
+
+func getHeaderLimits() HeaderLimits {
+	defer utility.RMonitor(headerLimitsLock)()
+	return headerLimits
+}
+
+// suspiciousHeaders reports why r breaks the configured header limits, or ""
+// if it does not.
+func suspiciousHeaders(r *http.Request) string {
+	limits := getHeaderLimits()
+	total := 0
+
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			if limits.MaxValueSize > 0 && len(v) > limits.MaxValueSize {
+				return "header " + k + " too long"
+			}
+			total += len(k) + len(v) + 4 // ": " and CRLF
+		}
+	}
+
+	if limits.MaxTotalSize > 0 && total > limits.MaxTotalSize {
+		return "headers too large"
+	}
+
+	return ""
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderLimits(t *testing.T) {
+	SetHeaderLimits(HeaderLimits{MaxTotalSize: 512, MaxValueSize: 128})
+	t.Cleanup(func() { SetHeaderLimits(HeaderLimits{}) })
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"within limits", http.Header{"X-Note": {"short"}}, http.StatusOK},
+		{"value too long", http.Header{"X-Note": {strings.Repeat("a", 200)}}, http.StatusBadRequest},
+		{"headers too large", http.Header{"X-A": {strings.Repeat("a", 100)}, "X-B": {strings.Repeat("b", 100)}, "X-C": {strings.Repeat("c", 100)}, "X-D": {strings.Repeat("d", 100)}, "X-E": {strings.Repeat("e", 100)}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/Public/Home", nil)
+		for k, vs := range tt.header {
+			r.Header[k] = vs
+		}
+
+		if w := serve(publicRoot{}, r); w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+
+	SetHeaderLimits(HeaderLimits{})
+
+	r := httptest.NewRequest(http.MethodGet, "/Public/Home", nil)
+	r.Header.Set("X-Note", strings.Repeat("a", 200))
+	if w := serve(publicRoot{}, r); w.Code != http.StatusOK {
+		t.Errorf("limits disabled: got %d, want 200", w.Code)
+	}
+}
+
+// rawRequest sends req as it is to srv and returns the status of the answer.
+func rawRequest(t *testing.T, srv *httptest.Server, req string) int {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestHeaderLimitsOverTheWire(t *testing.T) {
+	SetHeaderLimits(HeaderLimits{MaxValueSize: 128})
+	t.Cleanup(func() { SetHeaderLimits(HeaderLimits{}) })
+
+	srv := httptest.NewServer(http.HandlerFunc(getHandler(publicRoot{}, "")))
+	defer srv.Close()
+
+	if status := rawRequest(t, srv, "GET /Public/Home HTTP/1.1\r\nHost: x\r\nX-Note: "+strings.Repeat("a", 200)+"\r\n\r\n"); status != http.StatusBadRequest {
+		t.Errorf("value too long: got %d, want 400", status)
+	}
+
+	// Smuggling through the framing headers never reaches the handler
+	if status := rawRequest(t, srv, "POST /Public/Home HTTP/1.1\r\nHost: x\r\nContent-Length: 0\r\nContent-Length: 5\r\n\r\nhello"); status != http.StatusBadRequest {
+		t.Errorf("repeated Content-Length: got %d, want 400 from net/http", status)
+	}
+
+	seen := make(chan http.Header, 1)
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Clone()
+	}))
+	defer echo.Close()
+
+	rawRequest(t, echo, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	if h := <-seen; h.Get("Content-Length") != "" {
+		t.Errorf("Content-Length %q kept along with Transfer-Encoding", h.Get("Content-Length"))
+	}
+}
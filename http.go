@@ -4,18 +4,21 @@
 package goapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mattia-cabrini/go-utility"
 )
 
 func startSession(w http.ResponseWriter, r *http.Request) (s *Session, b bool, err error) {
-	c, err := r.Cookie("sessionid")
+	c, err := r.Cookie(getCookieConfig().Name)
 
 	if err == http.ErrNoCookie {
 		s, err = newSession("")
@@ -31,88 +34,303 @@ func startSession(w http.ResponseWriter, r *http.Request) (s *Session, b bool, e
 	return
 }
 
-func handleRequest(m *utility.Method, request string, hasAuth bool, w http.ResponseWriter, r *http.Request) {
+// refreshSessionCookie replaces the session cookie set by startSession with
+// one reflecting the session as the handler left it: regenerated under a new
+// ID, or deleted.
+func refreshSessionCookie(w http.ResponseWriter, s *Session) {
+	c := s.GetCookie()
+
+	if _, ok := getSessionStore().Get(c.Value); !ok {
+		c.Value = ""
+		c.MaxAge = -1
+		c.Expires = time.Time{}
+	}
+
+	h := w.Header()
+	cookies := h.Values("Set-Cookie")
+	h.Del("Set-Cookie")
+
+	for _, v := range cookies {
+		if !strings.HasPrefix(v, c.Name+"=") {
+			h.Add("Set-Cookie", v)
+		}
+	}
+
+	http.SetCookie(w, c)
+}
+
+// route collects what getHandler resolved about the requested path.
+type route struct {
+	controller interface{}
+	request    string
+	method     string // name of the handler method
+	hasAuth    bool
+	public     bool // served to anonymous users: no Login redirect at all
+	deprecated bool
+	sunset     string // date the deprecated route goes away, if known
+	pool       string // worker pool the handler runs in, if any
+	timeout    string // overrides the handler timeout of the Server, if set
+	params     map[string]string
+}
+
+func handleRequest(m *utility.Method, rt route, w http.ResponseWriter, r *http.Request) {
 	var res []interface{}
 	var err error
 
-	defer func() {
-		if i := recover(); i != nil {
-			utility.Logf(utility.ERROR, "%v", i)
+	if m == nil {
+		writeStatus(w, r, http.StatusNotFound)
+		return
+	}
+
+	if rt.deprecated {
+		utility.Logf(utility.WARNING, "deprecated route hit: %s", r.URL.Path)
+		w.Header().Set("Deprecation", "true")
+
+		if rt.sunset != "" {
+			w.Header().Set("Sunset", rt.sunset)
 		}
-	}()
+	}
 
-	if m == nil {
-		w.WriteHeader(http.StatusNotFound)
+	if tooManyQueryParams(r) {
+		writeStatus(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if !acceptsContentType(r, routeConsumes(rt.controller, rt.request)) {
+		writeStatus(w, r, http.StatusUnsupportedMediaType)
 		return
 	}
 
+	body := limitBody(r)
+
 	// utility.Logf(utility.INFO, "session start")
 	s, newSession, err := startSession(w, r)
 
 	if err != nil {
 		utility.Logf(utility.ERROR, "%v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, r, http.StatusInternalServerError)
 		return
 	}
 
 	if s == nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if ok, err := checkCSRF(w, r); err != nil {
+		utility.Logf(utility.ERROR, "%v\n", err)
+		writeStatus(w, r, http.StatusInternalServerError)
+		return
+	} else if !ok {
+		utility.Logf(utility.WARNING, "missing or invalid CSRF token: %s %s", r.Method, r.URL.Path)
+		writeStatus(w, r, http.StatusForbidden)
 		return
 	}
 
-	if newSession && request != "Login" {
+	if newSession && rt.request != "Login" && !rt.public {
 		w.Header().Set("Location", "/Login")
 		w.WriteHeader(http.StatusTemporaryRedirect)
 		return
 	}
 
-	if hasAuth && s.User() == "" {
+	if rt.hasAuth && !rt.public && s.User() == "" {
 		w.Header().Set("Location", "/Login")
 		w.WriteHeader(http.StatusTemporaryRedirect)
 		return
 	}
 
-	switch politeRequest := initPoliteRequest(r); m.NumIn() {
+	// The pool slot is handed over to a handler outliving its timeout
+	releasePool := func() {}
+	defer func() { releasePool() }()
+
+	if rt.pool != "" {
+		if p := getWorkerPool(rt.pool); p == nil {
+			utility.Logf(utility.WARNING, "unknown worker pool %q for %s", rt.pool, r.URL.Path)
+		} else if release, ok := p.acquire(r.Context()); ok {
+			releasePool = release
+		} else {
+			utility.Logf(utility.WARNING, "worker pool %q busy: %s %s", rt.pool, r.Method, r.URL.Path)
+			writeStatus(w, r, http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), controllerKey{}, rt.controller))
+
+	if rt.params != nil {
+		r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, rt.params))
+	}
+
+	timeout := handlerTimeout(r, rt)
+	cancel := context.CancelFunc(func() {})
+
+	if timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(r.Context())
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	var args []interface{}
+
+	switch m.NumIn() {
 	case 1:
-		res, err = m.F(s)
+		args = []interface{}{s}
 	case 2:
-		res, err = m.F(s, politeRequest)
+		args = []interface{}{s, initPoliteRequest(r)}
 	default:
 		utility.Logf(utility.ERROR, "handler for %s has %d parameters\n", r.RequestURI, m.NumIn())
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, r, http.StatusInternalServerError)
 		return
 	}
 
+	var handlerStart = time.Now()
+
+	if timeout <= 0 {
+		res, err = m.F(args...)
+	} else {
+		hr, done, ok := callHandler(m, args, timeout, cancel)
+
+		if !ok {
+			utility.Logf(utility.WARNING, "handler timed out after %v: %s %s", timeout, r.Method, r.URL.Path)
+
+			release := releasePool
+			releasePool = func() {}
+			go func() {
+				<-done
+				release()
+			}()
+
+			writeStatus(w, r, http.StatusServiceUnavailable)
+			return
+		}
+
+		if hr.recovered == http.ErrAbortHandler {
+			panic(hr.recovered)
+		} else if hr.recovered != nil {
+			getPanicHandler(r)(w, r, hr.recovered)
+			return
+		}
+
+		res, err = hr.res, hr.err
+	}
+
+	// The rest of an oversized body is left unread: close the connection
+	// rather than have net/http drain it
+	if body != nil && body.exceeded.Load() {
+		w.Header().Set("Connection", "close")
+	}
+
+	RecordTiming(r.Context(), "handler", time.Since(handlerStart))
+
 	if err != nil {
 		utility.Logf(utility.ERROR, "%v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	refreshSessionCookie(w, s)
+
+	if l := requestLogFrom(r.Context()); l != nil {
+		l.User = s.User()
+	}
+
+	if isErrorOnlyHandler(rt.controller, rt.method) {
+		if err, _ = res[0].(error); err != nil {
+			utility.Logf(utility.ERROR, "%v\n", err)
+			writeError(w, r, errorStatus(err), err)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
 		return
 	}
 
+	if len(res) > 1 {
+		if err, _ = res[1].(error); err != nil {
+			utility.Logf(utility.ERROR, "%v\n", err)
+			writeError(w, r, errorStatus(err), err)
+			return
+		}
+	}
+
 	respi := res[0]
 
 	var resp Response
 	var ok bool
 
 	if resp, ok = respi.(Response); !ok {
-		resp := InitJsonResponse()
-		resp.Set("data", respi)
+		jr := InitJsonResponse()
+		jr.Set("data", respi)
+		resp = jr
+	}
+
+	if fn := getResponseInterceptor(); fn != nil {
+		if ir := fn(r, resp); ir != nil {
+			resp = ir
+		}
+	}
+
+	writeResponse(resp, w, r)
+}
+
+var responseInterceptorLock = &sync.RWMutex{}
+var responseInterceptor func(r *http.Request, resp Response) Response
+
+// SetResponseInterceptor sets fn to run on every response a handler returns,
+// before it is written. fn may modify resp, e.g. adding a field to every
+// JsonResponse, or return a different Response to be written in its place;
+// returning nil keeps resp. Error answers and static files are not
+// intercepted. A nil fn removes the interceptor.
+func SetResponseInterceptor(fn func(r *http.Request, resp Response) Response) {
+	defer utility.Monitor(responseInterceptorLock)()
+	responseInterceptor = fn
+}
+
+func getResponseInterceptor() func(r *http.Request, resp Response) Response {
+	defer utility.RMonitor(responseInterceptorLock)()
+	return responseInterceptor
+}
+
+// writeResponse writes resp as the answer to r.
+func writeResponse(resp Response, w http.ResponseWriter, r *http.Request) {
+	if rb, ok := resp.(requestBinder); ok {
+		rb.bindRequest(r)
 	}
 
 	resp.Write(w)
 }
 
 func handleDist(dist string, uri URI, w http.ResponseWriter, r *http.Request) {
+	var err error
+
 	uri.ResetStack()
 
-	err := handleFile(dist, &uri, w, r)
+	if !uriWithinRoot(dist, uri) {
+		utility.Logf(utility.WARNING, "rejected path outside of dist: `%s`", uri.path)
+		distNotFound(w, r)
+		return
+	}
+
+	if isStrictStatic() {
+		err = handleExactFile(dist, &uri, w, r)
+	} else {
+		err = handleFile(dist, &uri, w, r)
+	}
+
+	if err != nil && serveSPAFallback(dist, &uri, w, r) {
+		err = nil
+	}
 
 	if err != nil {
-		utility.Logf(utility.INFO, "not found `%s`"+uri.path)
-		http.NotFound(w, r)
+		utility.Logf(utility.INFO, "not found `%s`", uri.path)
+		distNotFound(w, r)
 	}
 }
 
+func distNotFound(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, r, http.StatusNotFound)
+}
+
 func handleFile(filePath string, uri *URI, w http.ResponseWriter, r *http.Request) (err error) {
 	var s os.FileInfo
 	var part = ""
@@ -135,7 +353,7 @@ func handleFile(filePath string, uri *URI, w http.ResponseWriter, r *http.Reques
 			if s.IsDir() {
 				err = handleFile(filePath+"/"+"index.html", nil, w, r)
 			} else {
-				http.ServeFile(w, r, filePath)
+				serveStaticFile(w, r, filePath, s)
 			}
 		}
 	}
@@ -144,94 +362,156 @@ func handleFile(filePath string, uri *URI, w http.ResponseWriter, r *http.Reques
 }
 
 func getHandler(controller interface{}, dist string) func(http.ResponseWriter, *http.Request) {
-	s, err := os.Stat(dist)
+	if dist != "" {
+		s, err := os.Stat(dist)
 
-	if err != nil {
-		err = fmt.Errorf("could not stat %s: %v", dist, err)
-		utility.Logf(utility.FATAL, "%v", utility.AppendError(err))
+		if err != nil {
+			err = fmt.Errorf("could not stat %s: %v", dist, err)
+			utility.Logf(utility.FATAL, "%v", utility.AppendError(err))
+		}
+
+		if !s.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dist)
+			utility.Logf(utility.FATAL, "%v", utility.AppendError(err))
+		}
 	}
 
-	if !s.IsDir() {
-		err = fmt.Errorf("%s is not a directory", dist)
+	if err := validateController(controller); err != nil {
 		utility.Logf(utility.FATAL, "%v", utility.AppendError(err))
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
+	handler := chainMiddlewares(func(w http.ResponseWriter, r *http.Request) {
 		var f *utility.Method
-		var request string
-		var hasAuth = false
+		var rt route
+		var allowed []string
 
 		controller := controller
 		uri := InitURI(r.RequestURI)
 
-		utility.Logf(utility.INFO, "URI: %s", r.RequestURI)
+		if reason := suspiciousHeaders(r); reason != "" {
+			utility.Logf(utility.WARNING, "rejected request from %s: %s", r.RemoteAddr, reason)
+			writeStatus(w, r, http.StatusBadRequest)
+			return
+		}
+
+		if handleMaintenance(w, r) {
+			return
+		}
+
+		if handleCORS(w, r) {
+			return
+		}
+
+		if serveStaticFirst(dist, uri, w, r) {
+			return
+		}
 
 		for uri.StackCount() > 1 && controller != nil {
 			controllerName := uri.Pop()
+			paramsTag := propertyTag(controller, controllerName, "params")
 			controllerAuth := utility.GetProperty(controller, controllerName, "", "controller", "auth")
+			controllerPublic := utility.GetProperty(controller, controllerName, "", "controller", "public")
+
+			if utility.GetProperty(controller, controllerName, "", "controller", "deprecated") != nil {
+				rt.deprecated = true
+				rt.sunset = sunsetDate(propertyTag(controller, controllerName, "sunset"))
+			}
+
+			// The innermost controller declaring a pool wins
+			if pool := propertyTag(controller, controllerName, "pool"); pool != "" {
+				rt.pool = pool
+			}
+
+			// The innermost controller declaring a timeout wins
+			if timeout := propertyTag(controller, controllerName, "timeout"); timeout != "" {
+				rt.timeout = timeout
+			}
 
+			// The innermost controller declaring auth or public wins
 			if controllerAuth != nil {
-				hasAuth = true
+				rt.hasAuth = true
+				rt.public = false
 				controller = controllerAuth
+			} else if controllerPublic != nil {
+				rt.hasAuth = false
+				rt.public = true
+				controller = controllerPublic
 			} else {
 				controller = utility.GetProperty(controller, controllerName, "", "controller")
 			}
+
+			if controller != nil && paramsTag != "" {
+				if rt.params == nil {
+					rt.params = make(map[string]string)
+				}
+				if !popPathParams(&uri, paramsTag, rt.params) {
+					controller = nil
+				}
+			}
 		}
 
 		if controller != nil {
-			request = uri.Pop()
+			rt.controller = controller
+			rt.request = uri.Pop()
+
+			if pool := routePool(controller, rt.request); pool != "" {
+				rt.pool = pool
+			}
 
-			if request != "" {
-				f = utility.GetMethod(controller, request, "Request")
+			if timeout := routeTimeout(controller, rt.request); timeout != "" {
+				rt.timeout = timeout
+			}
+
+			if rt.request != "" {
+				rt.method, f, allowed = resolveHandler(controller, rt.request, r.Method)
 			}
 
 		}
 
 		if f != nil {
-			handleRequest(f, request, hasAuth, w, r)
-		} else {
+			if l := requestLogFrom(r.Context()); l != nil {
+				l.Route = reflect.TypeOf(controller).Name() + "." + rt.method
+			}
+			handleRequest(f, rt, w, r)
+		} else if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeStatus(w, r, http.StatusMethodNotAllowed)
+		} else if dist != "" {
 			// no handler --> search in dist
 			handleDist(dist, uri, w, r)
+		} else {
+			distNotFound(w, r)
 		}
-	}
-}
-
-func safeExit(sessionDumpPath string) {
-	utility.Logf(utility.INFO, "SafeExit")
-
-	chronoSerialize(sessionDumpPath)
-
-	os.Exit(0)
-}
-
-func Run(rootController interface{}, dist string, bind string, cert string, key string, sessionDumpPath string) {
-	http.HandleFunc("/", getHandler(rootController, dist))
+	})
 
-	if err := RestoreSessions(sessionDumpPath); err != nil {
-		utility.Logf(utility.ERROR, "could not restore sessions: %s", err.Error())
-	}
-
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM) // -syscall.SIGHUP
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, l := withRequestLog(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		w = rec
 
-	go func() {
-		sig := <-sigs
-		fmt.Printf("Ricevuto segnale: %v\n", sig)
-		safeExit(sessionDumpPath)
-	}()
+		if isServerTimingEnabled() {
+			r, w = withServerTiming(r, w)
+		}
 
-	if sessionDumpPath != "" {
-		go func() {
-			for {
-				time.Sleep(1 * time.Second)
-				chronoSerialize(sessionDumpPath)
+		defer func() {
+			l.Status = rec.status
+			if l.Status == 0 {
+				l.Status = http.StatusOK
 			}
+			l.Bytes = rec.bytes
+			l.Duration = time.Since(l.Time)
+			getRequestLogger()(*l)
 		}()
-	}
 
-	err := http.ListenAndServeTLS(bind, cert, key, nil)
+		defer func() {
+			if i := recover(); i == http.ErrAbortHandler {
+				panic(i)
+			} else if i != nil {
+				utility.Logf(utility.ERROR, "%v\n%s", i, debug.Stack())
+				getPanicHandler(r)(w, r, i)
+			}
+		}()
 
-	if err != nil {
-		utility.Mypanic(err)
+		handler(w, withLocals(r))
 	}
 }
@@ -0,0 +1,316 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve dispatches req to root, with no static files, and returns the
+// recorded response.
+func serve(root interface{}, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	getHandler(root, "")(w, req)
+	return w
+}
+
+type errorOnlyController struct{}
+
+func (errorOnlyController) OkDelete(s *Session) error {
+	return nil
+}
+
+func (errorOnlyController) FailDelete(s *Session) error {
+	return errors.New("boom")
+}
+
+type errorOnlyRoot struct {
+	Items errorOnlyController `controller:"true" public:"true"`
+}
+
+func TestErrorOnlyHandler(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/Items/Ok", http.StatusNoContent},
+		{"/Items/Fail", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		w := serve(errorOnlyRoot{}, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("DELETE %s: got %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+type landingController struct{}
+
+func (landingController) HomeGet(s *Session) string {
+	return "welcome"
+}
+
+type publicRoot struct {
+	Public  landingController `controller:"true" public:"true"`
+	Private landingController `controller:"true"`
+}
+
+func TestPublicRouteServesAnonymousUsers(t *testing.T) {
+	w := serve(publicRoot{}, httptest.NewRequest(http.MethodGet, "/Public/Home", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "welcome") {
+		t.Errorf("public route: got %d %q, want the content", w.Code, w.Body.String())
+	}
+
+	w = serve(publicRoot{}, httptest.NewRequest(http.MethodGet, "/Private/Home", nil))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/Login" {
+		t.Errorf("private route: got %d, want a redirect to /Login", w.Code)
+	}
+}
+
+type helperController struct{}
+
+func (helperController) ItemGet(s *Session) string {
+	return "item"
+}
+
+// CacheGet is a helper, not a handler: it must neither stop the server from
+// starting nor be routed.
+func (helperController) CacheGet() map[string]string {
+	return nil
+}
+
+type helperRoot struct {
+	Api helperController `controller:"true" public:"true"`
+}
+
+func TestHelperMethodsAreNotRouted(t *testing.T) {
+	if err := validateController(helperRoot{}); err != nil {
+		t.Fatalf("controller with a helper method rejected: %v", err)
+	}
+
+	if w := serve(helperRoot{}, httptest.NewRequest(http.MethodGet, "/Api/Item", nil)); w.Code != http.StatusOK {
+		t.Errorf("GET /Api/Item: got %d, want 200", w.Code)
+	}
+	if w := serve(helperRoot{}, httptest.NewRequest(http.MethodGet, "/Api/Cache", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("GET /Api/Cache: got %d, want 404", w.Code)
+	}
+}
+
+type deprecatedRoot struct {
+	Old     landingController `controller:"true" public:"true" deprecated:"true" sunset:"2030-01-31"`
+	Current landingController `controller:"true" public:"true"`
+}
+
+func TestDeprecatedRouteHeaders(t *testing.T) {
+	w := serve(deprecatedRoot{}, httptest.NewRequest(http.MethodGet, "/Old/Home", nil))
+
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation %q, want true", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Thu, 31 Jan 2030 00:00:00 GMT" {
+		t.Errorf("Sunset %q", got)
+	}
+
+	w = serve(deprecatedRoot{}, httptest.NewRequest(http.MethodGet, "/Current/Home", nil))
+
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" {
+		t.Error("deprecation headers on a current route")
+	}
+}
+
+type namedController struct {
+	Name string
+}
+
+func (namedController) WhoGet(s *Session, pr PoliteRequest) (string, error) {
+	c, ok := ControllerFromContext(pr.Request.Context()).(namedController)
+	if !ok {
+		return "", errors.New("no controller in the context")
+	}
+	return "controller=" + c.Name, nil
+}
+
+type namedRoot struct {
+	Api namedController `controller:"true" public:"true"`
+}
+
+func TestControllerFromContext(t *testing.T) {
+	w := serve(namedRoot{Api: namedController{Name: "api"}}, httptest.NewRequest(http.MethodGet, "/Api/Who", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "controller=api") {
+		t.Errorf("body %q", w.Body.String())
+	}
+
+	if c := ControllerFromContext(context.Background()); c != nil {
+		t.Errorf("controller %v outside of a request", c)
+	}
+}
+
+type consumesController struct {
+	SaveConsumes struct{} `consumes:"application/json"`
+}
+
+func (consumesController) SavePost(s *Session) error {
+	return nil
+}
+
+type consumesRoot struct {
+	Api consumesController `controller:"true" public:"true"`
+}
+
+func TestRouteConsumes(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctype  string
+		body   string
+		status int
+	}{
+		{"json", "application/json; charset=utf-8", `{"a":1}`, http.StatusNoContent},
+		{"form", "application/x-www-form-urlencoded", "a=1", http.StatusUnsupportedMediaType},
+		{"no content type", "", "a=1", http.StatusUnsupportedMediaType},
+		{"empty body", "application/x-www-form-urlencoded", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/Api/Save", strings.NewReader(tt.body))
+		if tt.ctype != "" {
+			r.Header.Set("Content-Type", tt.ctype)
+		}
+
+		if w := serve(consumesRoot{}, r); w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+type accountController struct{}
+
+func (accountController) SignInPost(s *Session) (Response, error) {
+	if _, err := s.Regenerate(); err != nil {
+		return nil, err
+	}
+	s.SetUser("alice")
+	return InitRedirectResponse("/Home", http.StatusSeeOther), nil
+}
+
+func (accountController) SignOutPost(s *Session) (Response, error) {
+	s.Delete()
+	return InitRedirectResponse("/", http.StatusSeeOther), nil
+}
+
+type accountRoot struct {
+	Account accountController `controller:"true" public:"true"`
+}
+
+// sessionCookie returns the session cookie set by w, or nil.
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	var found *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == getCookieConfig().Name {
+			if found != nil {
+				return nil // set twice
+			}
+			found = c
+		}
+	}
+	return found
+}
+
+func TestSessionCookieFollowsRedirectingHandler(t *testing.T) {
+	withSessionStore(t)
+
+	s := mustSession(t)
+	oldID := s.ID()
+
+	r := httptest.NewRequest(http.MethodPost, "/Account/SignIn", nil)
+	r.AddCookie(&http.Cookie{Name: getCookieConfig().Name, Value: oldID})
+	w := serve(accountRoot{}, r)
+
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/Home" {
+		t.Fatalf("sign in: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	c := sessionCookie(w)
+	if c == nil || c.Value == "" || c.Value == oldID {
+		t.Fatalf("sign in: session cookie %v, want one with a new ID", c)
+	}
+	if regenerated, ok := getSessionStore().Get(c.Value); !ok || regenerated.User() != "alice" {
+		t.Error("sign in: cookie does not point to the regenerated session")
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/Account/SignOut", nil)
+	r.AddCookie(c)
+	w = serve(accountRoot{}, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("sign out: status %d", w.Code)
+	}
+	if c = sessionCookie(w); c == nil || c.MaxAge >= 0 {
+		t.Errorf("sign out: session cookie %v, want it expired", c)
+	}
+}
+
+func TestResponseInterceptor(t *testing.T) {
+	SetResponseInterceptor(func(r *http.Request, resp Response) Response {
+		if jr, ok := resp.(JsonResponse); ok {
+			jr.Set("version", "1.2.3")
+		}
+		return nil
+	})
+	t.Cleanup(func() { SetResponseInterceptor(nil) })
+
+	w := serve(publicRoot{}, httptest.NewRequest(http.MethodGet, "/Public/Home", nil))
+
+	var body struct{ Data, Version string }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+	if body.Data != "welcome" || body.Version != "1.2.3" {
+		t.Errorf("body %q, want the data and the added version", w.Body.String())
+	}
+
+	// Error answers are not intercepted
+	w = serve(publicRoot{}, httptest.NewRequest(http.MethodGet, "/Public/Missing", nil))
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "version") {
+		t.Errorf("not found: got %d %q", w.Code, w.Body.String())
+	}
+}
+
+type badRequestController struct{}
+
+// FooRequest takes a parameter no handler can take.
+func (badRequestController) FooRequest(n int) string {
+	return "never"
+}
+
+type badRequestRoot struct {
+	Api badRequestController `controller:"true" public:"true"`
+}
+
+func TestBadRequestHandlerFailsStartup(t *testing.T) {
+	err := validateController(badRequestRoot{})
+	if err == nil || !strings.Contains(err.Error(), "FooRequest") {
+		t.Fatalf("validateController: err %v, want one naming FooRequest", err)
+	}
+
+	select {
+	case err := <-NewServer(badRequestRoot{}, WithBind(freeAddr(t))).RunWithContext(context.Background()):
+		if err == nil || !strings.Contains(err.Error(), "FooRequest") {
+			t.Errorf("RunWithContext: err %v, want one naming FooRequest", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server started with a bad handler")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+type localsKey struct{}
+
+// locals holds the request-scoped values of a single request.
+type locals struct {
+	lock   *sync.RWMutex
+	values map[string]interface{}
+}
+
+// withLocals attaches an empty request-scoped store to r.
+func withLocals(r *http.Request) *http.Request {
+	l := &locals{
+		lock:   &sync.RWMutex{},
+		values: make(map[string]interface{}),
+	}
+	return r.WithContext(context.WithValue(r.Context(), localsKey{}, l))
+}
+
+func getLocals(r *http.Request) *locals {
+	l, _ := r.Context().Value(localsKey{}).(*locals)
+	return l
+}
+
+// SetLocal stores v under key for the rest of the request. Unlike session
+// data, locals are never persisted and are dropped when the request ends.
+// Middlewares can set them too, passing the request on as pr.Request:
+//
+//	pr := &goapi.PoliteRequest{Request: r}
+//	pr.SetLocal("user", user)
+//	next(w, pr.Request)
+func (pr *PoliteRequest) SetLocal(key string, v interface{}) {
+	l := getLocals(pr.Request)
+	if l == nil {
+		pr.Request = withLocals(pr.Request)
+		l = getLocals(pr.Request)
+	}
+
+	defer utility.Monitor(l.lock)()
+	l.values[key] = v
+}
+
+// Local returns the value stored under key by SetLocal, or nil.
+func (pr *PoliteRequest) Local(key string) interface{} {
+	l := getLocals(pr.Request)
+	if l == nil {
+		return nil
+	}
+
+	defer utility.RMonitor(l.lock)()
+	return l.values[key]
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type localsController struct{}
+
+func (localsController) WhoGet(s *Session, pr PoliteRequest) (string, error) {
+	user, _ := pr.Local("user").(string)
+	return "user=" + user, nil
+}
+
+type localsRoot struct {
+	Api localsController `controller:"true" public:"true"`
+}
+
+func TestLocalSetInMiddleware(t *testing.T) {
+	t.Cleanup(func() {
+		middlewaresLock.Lock()
+		middlewares = nil
+		middlewaresLock.Unlock()
+	})
+
+	UseMiddleware(func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			pr := &PoliteRequest{Request: r} // as in the SetLocal doc
+			pr.SetLocal("user", "alice")
+			next(w, pr.Request)
+		}
+	})
+
+	w := serve(localsRoot{}, httptest.NewRequest(http.MethodGet, "/Api/Who", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "user=alice") {
+		t.Errorf("body %q, want the local set by the middleware", w.Body.String())
+	}
+
+	// Locals do not leak into the next request.
+	other := PoliteRequest{Request: httptest.NewRequest(http.MethodGet, "/", nil)}
+	if v := other.Local("user"); v != nil {
+		t.Errorf("fresh request sees local %v", v)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// loginAttempt tracks the recent failed logins of a single user name.
+type loginAttempt struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var loginAttemptsLock = &sync.Mutex{}
+var loginAttempts = make(map[string]*loginAttempt)
+
+var loginMaxFailures = 5
+var loginLockoutWindow = 15 * time.Minute
+var loginMaxTracked = 10000
+
+// SetLoginLockout configures the brute-force protection of login handlers:
+// after maxFailures consecutive failed logins within window, the user name is
+// locked out for window. maxTracked bounds the number of user names tracked at
+// once; when the bound is hit the stalest entry not locked out is evicted.
+// If every tracked entry is locked out, the protection fails closed: user
+// names not tracked count as locked out until the first lockout expires, so
+// filling the store does not buy unlimited guesses against other accounts.
+// Values of maxFailures and maxTracked below 1 count as 1.
+func SetLoginLockout(maxFailures int, window time.Duration, maxTracked int) {
+	defer utility.Monitor(loginAttemptsLock)()
+
+	loginMaxFailures = max(maxFailures, 1)
+	loginLockoutWindow = window
+	loginMaxTracked = max(maxTracked, 1)
+}
+
+// IsLockedOut reports whether user is currently locked out.
+func IsLockedOut(user string) bool {
+	return LockoutRemaining(user) > 0
+}
+
+// LockoutRemaining returns how long user is still locked out for, or 0.
+// While the store is full of locked out entries, a user name not tracked is
+// locked out until the first of them expires; see SetLoginLockout.
+func LockoutRemaining(user string) time.Duration {
+	defer utility.Monitor(loginAttemptsLock)()
+
+	now := time.Now()
+
+	if a, ok := loginAttempts[user]; ok {
+		if d := a.lockedUntil.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+
+	if until := saturatedUntil(now); !until.IsZero() {
+		return until.Sub(now)
+	}
+
+	return 0
+}
+
+// saturatedUntil returns when the first lockout expires if the store is full
+// and every entry in it is locked out, or the zero time otherwise.
+// Must be called holding loginAttemptsLock.
+func saturatedUntil(now time.Time) time.Time {
+	if len(loginAttempts) < loginMaxTracked {
+		return time.Time{}
+	}
+
+	var first time.Time
+
+	for _, a := range loginAttempts {
+		if !now.Before(a.lockedUntil) {
+			return time.Time{}
+		}
+		if first.IsZero() || a.lockedUntil.Before(first) {
+			first = a.lockedUntil
+		}
+	}
+
+	return first
+}
+
+// RecordFailedLogin counts a failed login for user, locking it out once the
+// configured number of failures is reached.
+func RecordFailedLogin(user string) {
+	defer utility.Monitor(loginAttemptsLock)()
+
+	now := time.Now()
+
+	a, ok := loginAttempts[user]
+	if !ok {
+		if !evictLoginAttempts(now) {
+			utility.Logf(utility.WARNING, "login attempts store full of locked out users, %q counts as locked out", user)
+			return
+		}
+		a = &loginAttempt{}
+		loginAttempts[user] = a
+	} else if now.Sub(a.lastFailure) > loginLockoutWindow {
+		a.failures = 0
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	if a.failures >= loginMaxFailures {
+		a.failures = 0
+		a.lockedUntil = now.Add(loginLockoutWindow)
+		utility.Logf(utility.WARNING, "user %q locked out until %v", user, a.lockedUntil)
+	}
+}
+
+// ResetAttempts forgets the failed logins of user; call it after a successful login.
+func ResetAttempts(user string) {
+	defer utility.Monitor(loginAttemptsLock)()
+	delete(loginAttempts, user)
+}
+
+// evictLoginAttempts makes room for a new entry and reports whether there is
+// any. Stale entries are dropped first; if the store is still full the entry
+// with the oldest failure goes, unless it is locked out: evicting it would
+// lift the lockout, so locked out entries are never evicted.
+// Must be called holding loginAttemptsLock.
+func evictLoginAttempts(now time.Time) bool {
+	if len(loginAttempts) < loginMaxTracked {
+		return true
+	}
+
+	var oldestUser string
+	var oldest time.Time
+
+	for user, a := range loginAttempts {
+		if now.Before(a.lockedUntil) {
+			continue
+		}
+
+		if now.Sub(a.lastFailure) > loginLockoutWindow {
+			delete(loginAttempts, user)
+		} else if oldestUser == "" || a.lastFailure.Before(oldest) {
+			oldestUser, oldest = user, a.lastFailure
+		}
+	}
+
+	if len(loginAttempts) >= loginMaxTracked {
+		if oldestUser == "" {
+			return false
+		}
+		delete(loginAttempts, oldestUser)
+	}
+
+	return true
+}
+
+// InitLockoutResponse creates a 429 Too Many Requests JsonResponse telling the
+// client, also through the Retry-After header, when user may try again.
+func InitLockoutResponse(user string) JsonResponse {
+	retry := int(LockoutRemaining(user).Seconds()) + 1
+
+	jr := InitJsonResponse()
+	jr.SetStatus(http.StatusTooManyRequests)
+	jr.SetHeader("Retry-After", strconv.Itoa(retry))
+	jr.Set("retryAfter", retry)
+	jr.AppendErrorStr("too many failed login attempts")
+
+	return jr
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// withLoginLockout configures the lockout for the duration of the test,
+// starting from an empty store.
+func withLoginLockout(t *testing.T, maxFailures int, window time.Duration, maxTracked int) {
+	t.Helper()
+
+	SetLoginLockout(maxFailures, window, maxTracked)
+	loginAttempts = make(map[string]*loginAttempt)
+
+	t.Cleanup(func() {
+		SetLoginLockout(5, 15*time.Minute, 10000)
+		loginAttempts = make(map[string]*loginAttempt)
+	})
+}
+
+func TestLoginLockoutAndReset(t *testing.T) {
+	withLoginLockout(t, 3, time.Minute, 100)
+
+	for i := 0; i < 2; i++ {
+		RecordFailedLogin("alice")
+		if IsLockedOut("alice") {
+			t.Fatalf("locked out after %d failures, want 3", i+1)
+		}
+	}
+
+	RecordFailedLogin("alice")
+	if !IsLockedOut("alice") {
+		t.Fatal("not locked out after 3 failures")
+	}
+
+	jr := InitLockoutResponse("alice")
+	if jr.status != http.StatusTooManyRequests || jr.headers["Retry-After"] == "" {
+		t.Errorf("lockout response: status %d, Retry-After %q", jr.status, jr.headers["Retry-After"])
+	}
+
+	ResetAttempts("alice")
+	if IsLockedOut("alice") {
+		t.Fatal("still locked out after ResetAttempts")
+	}
+}
+
+func TestLoginLockoutSurvivesEviction(t *testing.T) {
+	withLoginLockout(t, 1, time.Minute, 10)
+
+	RecordFailedLogin("victim")
+	if !IsLockedOut("victim") {
+		t.Fatal("victim not locked out")
+	}
+
+	// Flood the store with other user names: the locked out entry must stay
+	for i := 0; i < 100; i++ {
+		RecordFailedLogin(fmt.Sprintf("user%d", i))
+	}
+
+	if !IsLockedOut("victim") {
+		t.Fatal("lockout lifted by evicting the victim")
+	}
+	if len(loginAttempts) > 10 {
+		t.Errorf("tracking %d user names, want at most 10", len(loginAttempts))
+	}
+}
+
+func TestLoginLockoutEvictsUnlocked(t *testing.T) {
+	withLoginLockout(t, 3, time.Minute, 2)
+
+	RecordFailedLogin("a")
+	RecordFailedLogin("b")
+	RecordFailedLogin("c")
+
+	if _, ok := loginAttempts["a"]; ok {
+		t.Error("oldest unlocked entry not evicted")
+	}
+	if _, ok := loginAttempts["c"]; !ok {
+		t.Error("new entry not tracked")
+	}
+}
+
+func TestLoginLockoutClampsMaxFailures(t *testing.T) {
+	withLoginLockout(t, 0, time.Minute, 100)
+
+	RecordFailedLogin("bob")
+	if !IsLockedOut("bob") {
+		t.Fatal("maxFailures 0 should lock out at the first failure")
+	}
+}
+
+func TestLoginLockoutFailsClosedWhenSaturated(t *testing.T) {
+	withLoginLockout(t, 1, time.Minute, 3)
+
+	for _, user := range []string{"a", "b", "c"} {
+		RecordFailedLogin(user)
+	}
+
+	// Every tracked name is locked out: an untracked one must not get
+	// unlimited guesses
+	if !IsLockedOut("victim") {
+		t.Fatal("untracked user not locked out while the store is saturated")
+	}
+	if jr := InitLockoutResponse("victim"); jr.status != http.StatusTooManyRequests {
+		t.Errorf("lockout response status %d, want 429", jr.status)
+	}
+
+	// Once a lockout expires the store has room again
+	loginAttempts["a"].lockedUntil = time.Now().Add(-time.Second)
+	if IsLockedOut("victim") {
+		t.Error("untracked user still locked out with room in the store")
+	}
+}
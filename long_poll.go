@@ -0,0 +1,39 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// LongPoll holds the request until a value is received from ch, answering
+// with it as a JsonResponse "data" field, or until timeout elapses, ch is
+// closed or ctx (usually the request context) is done, answering 204 No
+// Content. A non-positive timeout waits for ch or ctx alone, which ties up a
+// connection for as long as the client waits: prefer a bounded timeout.
+func LongPoll(ctx context.Context, ch <-chan interface{}, timeout time.Duration) Response {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	select {
+	case v, ok := <-ch:
+		if ok {
+			jr := InitJsonResponse()
+			jr.Set("data", v)
+			return jr
+		}
+	case <-ctx.Done():
+	}
+
+	return InitEmptyResponse(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLongPollData(t *testing.T) {
+	ch := make(chan interface{}, 1)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ch <- "update"
+	}()
+
+	w := httptest.NewRecorder()
+	LongPoll(context.Background(), ch, time.Second).Write(w)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+
+	var body struct{ Data string }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Data != "update" {
+		t.Errorf("body %q", w.Body.String())
+	}
+}
+
+func TestLongPollNoContent(t *testing.T) {
+	closed := make(chan interface{})
+	close(closed)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		ch      <-chan interface{}
+		timeout time.Duration
+	}{
+		{"timeout", context.Background(), make(chan interface{}), 10 * time.Millisecond},
+		{"closed channel", context.Background(), closed, time.Second},
+		{"context done", canceled, make(chan interface{}), 0},
+	}
+
+	for _, tt := range tests {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		LongPoll(tt.ctx, tt.ch, tt.timeout).Write(w)
+
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("%s: got %d %q, want an empty 204", tt.name, w.Code, w.Body.String())
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("%s: returned after %v", tt.name, d)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"html"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// MaintenanceOptions describes how requests are answered in maintenance mode.
+type MaintenanceOptions struct {
+	Message    string        // shown to clients; a generic one if empty
+	RetryAfter time.Duration // sent as Retry-After if positive
+	AllowedIPs []string      // IPs or CIDR blocks still served normally
+}
+
+type maintenanceState struct {
+	opts    MaintenanceOptions
+	allowed []*net.IPNet
+}
+
+var maintenanceLock = &sync.RWMutex{}
+var maintenance *maintenanceState
+
+// SetMaintenanceMode turns maintenance mode on or off. While on, every request
+// gets 503 Service Unavailable, as an HTML page or JSON depending on its
+// Accept header, except those coming from opts.AllowedIPs (resolved as by
+// PoliteRequest.ClientIP) and health checks. opts is ignored when turning
+// maintenance mode off.
+func SetMaintenanceMode(on bool, opts MaintenanceOptions) error {
+	var state *maintenanceState
+
+	if on {
+		allowed, err := parseIPNets(opts.AllowedIPs)
+		if err != nil {
+			return err
+		}
+		if opts.Message == "" {
+			opts.Message = "The service is undergoing maintenance, please try again later."
+		}
+		state = &maintenanceState{opts: opts, allowed: allowed}
+	}
+
+	defer utility.Monitor(maintenanceLock)()
+	maintenance = state
+
+	return nil
+}
+
+func getMaintenance() *maintenanceState {
+	defer utility.RMonitor(maintenanceLock)()
+	return maintenance
+}
+
+// handleMaintenance answers r with 503 if maintenance mode applies to it, and
+// reports whether it did.
+func handleMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	m := getMaintenance()
+	if m == nil {
+		return false
+	}
+
+	pr := initPoliteRequest(r)
+	if ip := net.ParseIP(pr.ClientIP()); ip != nil && containsIP(m.allowed, ip) {
+		return false
+	}
+
+	if m.opts.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(m.opts.RetryAfter.Seconds())))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<!DOCTYPE html>\n<html><head><title>Maintenance</title></head><body><p>" +
+			html.EscapeString(m.opts.Message) + "</p></body></html>\n"))
+		return true
+	}
+
+	jr := InitJsonResponse()
+	jr.SetStatus(http.StatusServiceUnavailable)
+	jr.AppendErrorStr(m.opts.Message)
+	jr.Write(w)
+
+	return true
+}
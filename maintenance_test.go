@@ -0,0 +1,82 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Cleanup(func() { SetMaintenanceMode(false, MaintenanceOptions{}) })
+
+	err := SetMaintenanceMode(true, MaintenanceOptions{
+		Message:    "Back at <5>",
+		RetryAfter: 2 * time.Minute,
+		AllowedIPs: []string{"10.1.0.0/16"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// JSON by default.
+	w := serve(publicRoot{}, httptest.NewRequest(http.MethodGet, "/Public/Home", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "120" {
+		t.Errorf("Retry-After %q", ra)
+	}
+
+	var body struct{ Errors []string }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+	if len(body.Errors) != 1 || body.Errors[0] != "Back at <5>" {
+		t.Errorf("errors %q", body.Errors)
+	}
+
+	// HTML for browsers, with the message escaped.
+	r := httptest.NewRequest(http.MethodGet, "/Public/Home", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w = serve(publicRoot{}, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("html: status %d, want 503", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("html: Content-Type %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "Back at &lt;5&gt;") {
+		t.Errorf("html: body %q", w.Body.String())
+	}
+
+	// Allowed IPs bypass maintenance mode.
+	r = httptest.NewRequest(http.MethodGet, "/Public/Home", nil)
+	r.RemoteAddr = "10.1.2.3:4567"
+	if w = serve(publicRoot{}, r); w.Code != http.StatusOK {
+		t.Errorf("allowed IP: status %d, want 200", w.Code)
+	}
+
+	SetMaintenanceMode(false, MaintenanceOptions{})
+	if w = serve(publicRoot{}, httptest.NewRequest(http.MethodGet, "/Public/Home", nil)); w.Code != http.StatusOK {
+		t.Errorf("maintenance off: status %d, want 200", w.Code)
+	}
+}
+
+func TestMaintenanceModeBadAllowlist(t *testing.T) {
+	t.Cleanup(func() { SetMaintenanceMode(false, MaintenanceOptions{}) })
+
+	if err := SetMaintenanceMode(true, MaintenanceOptions{AllowedIPs: []string{"not an ip"}}); err == nil {
+		t.Error("no error for an invalid allowlist entry")
+	}
+	if getMaintenance() != nil {
+		t.Error("maintenance mode turned on despite the error")
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// Middleware wraps a handler to run code before and after it.
+type Middleware func(next http.HandlerFunc) http.HandlerFunc
+
+var middlewaresLock = &sync.RWMutex{}
+var middlewares []Middleware
+
+// UseMiddleware appends mw to the middleware chain every request goes
+// through, whether it is served by a controller or from dist. Middlewares run
+// in registration order before the handler and in reverse order after it.
+// It must be called before Run.
+func UseMiddleware(mw ...Middleware) {
+	defer utility.Monitor(middlewaresLock)()
+	middlewares = append(middlewares, mw...)
+}
+
+// chainMiddlewares wraps h in the registered middlewares, the first
+// registered being the outermost.
+func chainMiddlewares(h http.HandlerFunc) http.HandlerFunc {
+	defer utility.RMonitor(middlewaresLock)()
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
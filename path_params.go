@@ -0,0 +1,74 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type pathParamsKey struct{}
+
+// pathParamNames parses the params tag of a controller field: the names of
+// the path segments following the controller name, each written as {name} or
+// :name and separated by slashes, e.g. `params:"{userID}"`.
+func pathParamNames(tag string) ([]string, error) {
+	if tag == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(strings.Trim(tag, "/"), "/")
+	names := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		var name string
+
+		if n, ok := strings.CutPrefix(part, ":"); ok {
+			name = n
+		} else if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name = part[1 : len(part)-1]
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("invalid path parameter %q", part)
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// popPathParams pops a segment of uri for each parameter declared by tag and
+// stores it in params. It returns false if uri does not hold all of them
+// followed by a request name.
+func popPathParams(uri *URI, tag string, params map[string]string) bool {
+	names, err := pathParamNames(tag)
+	if err != nil {
+		return false
+	}
+
+	for _, name := range names {
+		if uri.StackCount() <= 1 {
+			return false
+		}
+
+		raw := uri.Pop()
+		if v, err := url.PathUnescape(raw); err == nil {
+			params[name] = v
+		} else {
+			params[name] = raw
+		}
+	}
+
+	return true
+}
+
+// PathParam returns the value of the path parameter name, declared with the
+// params tag of a controller along the route, or "" if there is none.
+func (pr *PoliteRequest) PathParam(name string) string {
+	params, _ := pr.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
@@ -6,13 +6,122 @@ package goapi
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/mattia-cabrini/go-utility"
 )
 
+// ErrEmptyBody is returned by BindJSON and BindJSONStrict when the request has no body.
+var ErrEmptyBody = errors.New("empty request body")
+
+// ErrTooManyParams is returned by FormParams, and reported by PostAssert, when
+// the request carries more parameters than allowed by SetMaxParams.
+var ErrTooManyParams = errors.New("too many parameters")
+
+var maxParamsLock = &sync.RWMutex{}
+var maxParams = 1000
+
+// SetMaxParams caps the number of query parameters (checked before the
+// handler runs, answering 400 Bad Request) and of form parameters (checked
+// by FormParams and PostAssert before parsing the form) a request may carry.
+// The default is 1000; 0 means no limit.
+func SetMaxParams(n int) {
+	defer utility.Monitor(maxParamsLock)()
+	maxParams = n
+}
+
+func getMaxParams() int {
+	defer utility.RMonitor(maxParamsLock)()
+	return maxParams
+}
+
+// tooManyQueryParams reports whether the query string of r has more
+// parameters than allowed, without parsing it.
+func tooManyQueryParams(r *http.Request) bool {
+	max := getMaxParams()
+	return max > 0 && r.URL.RawQuery != "" && strings.Count(r.URL.RawQuery, "&")+1 > max
+}
+
+var maxBodySizeLock = &sync.RWMutex{}
+var maxBodySize int64 = 32 << 20
+
+// SetMaxBodySize caps the bytes of a request body handlers may read; reading
+// past it fails with an *http.MaxBytesError, which answers 413 Request Entity
+// Too Large when returned by the handler, and the connection is closed rather
+// than drained. The default is 32 MiB; 0 means no limit, as bodies were before
+// the cap was introduced. Single handlers can change the limit with
+// PoliteRequest.SetMaxBodySize.
+func SetMaxBodySize(n int64) {
+	defer utility.Monitor(maxBodySizeLock)()
+	maxBodySize = n
+}
+
+func getMaxBodySize() int64 {
+	defer utility.RMonitor(maxBodySizeLock)()
+	return maxBodySize
+}
+
+// limitedBody is a request body failing once more than limit bytes are read.
+// http.MaxBytesReader is not used: its limit cannot be raised after the fact,
+// and it only closes the connection when given the ResponseWriter of net/http,
+// which the dispatcher wraps. The dispatcher closes it instead, see exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64 // 0 means no limit
+	read     int64
+	exceeded atomic.Bool // set once reading went past limit
+}
+
+// limitBody wraps the body of r in a limitedBody with the configured limit
+// and returns it, or nil if r has no body.
+func limitBody(r *http.Request) *limitedBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	lb := &limitedBody{ReadCloser: r.Body, limit: getMaxBodySize()}
+	r.Body = lb
+
+	return lb
+}
+
+func (lb *limitedBody) Read(b []byte) (int, error) {
+	if lb.limit <= 0 {
+		n, err := lb.ReadCloser.Read(b)
+		lb.read += int64(n)
+		return n, err
+	}
+
+	if lb.read > lb.limit {
+		lb.exceeded.Store(true)
+		return 0, &http.MaxBytesError{Limit: lb.limit}
+	}
+
+	// Read one byte more than allowed, to tell a body of exactly limit bytes
+	// from a longer one
+	if rest := lb.limit - lb.read + 1; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+
+	n, err := lb.ReadCloser.Read(b)
+	lb.read += int64(n)
+
+	if lb.read > lb.limit {
+		lb.exceeded.Store(true)
+		return n - int(lb.read-lb.limit), &http.MaxBytesError{Limit: lb.limit}
+	}
+
+	return n, err
+}
+
 // PoliteRequest embeds http.Request and provides helper methods for common tasks.
 type PoliteRequest struct {
 	*http.Request
@@ -23,6 +132,18 @@ func initPoliteRequest(r *http.Request) PoliteRequest {
 	return PoliteRequest{Request: r}
 }
 
+// SetMaxBodySize replaces the limit set by the package-level SetMaxBodySize
+// for this request, e.g. to accept large uploads on a single route. It must
+// be called before the body is read; n is counted from the start of the body
+// and 0 means no limit.
+func (pr *PoliteRequest) SetMaxBodySize(n int64) {
+	if lb, ok := pr.Body.(*limitedBody); ok {
+		lb.limit = n
+	} else if n > 0 && pr.Body != nil && pr.Body != http.NoBody {
+		pr.Body = &limitedBody{ReadCloser: pr.Body, limit: n}
+	}
+}
+
 // GetCookie retrieves the value of the cookie with the specified name.
 // Returns an error if the cookie does not exist or cannot be accessed.
 func (pr *PoliteRequest) GetCookie(name string) (string, error) {
@@ -45,9 +166,48 @@ func (pr *PoliteRequest) QueryParams() map[string]string {
 	return m
 }
 
+// QueryDefault returns the first value of the query parameter name, or def if
+// the parameter is absent or empty.
+func (pr *PoliteRequest) QueryDefault(name, def string) string {
+	if v := pr.URL.Query().Get(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// QueryInt returns the query parameter name parsed as an int.
+// The bool is false if the parameter is absent or not an integer.
+func (pr *PoliteRequest) QueryInt(name string) (int, bool) {
+	i, err := strconv.Atoi(pr.URL.Query().Get(name))
+	return i, err == nil
+}
+
+// QueryFloat returns the query parameter name parsed as a float64.
+// The bool is false if the parameter is absent or not a number.
+func (pr *PoliteRequest) QueryFloat(name string) (float64, bool) {
+	f, err := strconv.ParseFloat(pr.URL.Query().Get(name), 64)
+	return f, err == nil
+}
+
+// QueryBool returns the query parameter name parsed as a bool, accepting
+// true/false, 1/0 and yes/no case-insensitively.
+// The bool is false if the parameter is absent or not one of those values.
+func (pr *PoliteRequest) QueryBool(name string) (bool, bool) {
+	switch strings.ToLower(pr.URL.Query().Get(name)) {
+	case "true", "1", "yes":
+		return true, true
+	case "false", "0", "no":
+		return false, true
+	}
+	return false, false
+}
+
 // FormParams parses and returns HTML form POST parameters as a map[string]string.
 // Assumes fields were submitted via a standard HTML form.
 func (pr *PoliteRequest) FormParams() (map[string]string, error) {
+	if err := pr.checkFormParamCount(); err != nil {
+		return nil, err
+	}
 	if err := pr.ParseForm(); err != nil {
 		return nil, err
 	}
@@ -60,6 +220,44 @@ func (pr *PoliteRequest) FormParams() (map[string]string, error) {
 	return m, nil
 }
 
+// checkFormParamCount fails with ErrTooManyParams if the URL-encoded form
+// body carries more parameters than allowed. The fields are counted on the
+// raw body, left in place for ParseForm, so that an oversized form is
+// rejected before any map is built.
+func (pr *PoliteRequest) checkFormParamCount() error {
+	max := getMaxParams()
+	if max <= 0 {
+		return nil
+	}
+
+	n := 0
+
+	if pr.PostForm != nil {
+		for _, v := range pr.PostForm {
+			n += len(v)
+		}
+	} else {
+		mt, _, _ := mime.ParseMediaType(pr.Header.Get("Content-Type"))
+		if mt != "application/x-www-form-urlencoded" {
+			return nil
+		}
+
+		raw, err := pr.RawBody()
+		if err != nil {
+			return err
+		}
+		if len(raw) > 0 {
+			n = bytes.Count(raw, []byte("&")) + 1
+		}
+	}
+
+	if n > max {
+		return ErrTooManyParams
+	}
+
+	return nil
+}
+
 // JSONParams parses a JSON POST body (e.g., from an Axios request) and
 // returns its contents as a map[string]interface{}.
 func (pr *PoliteRequest) JSONParams() (map[string]interface{}, error) {
@@ -72,6 +270,98 @@ func (pr *PoliteRequest) JSONParams() (map[string]interface{}, error) {
 	return m, nil
 }
 
+// RequireJSONFields decodes the JSON body and checks that each of fields is
+// present at the top level, not null and not an empty string. It returns the
+// body and an error per missing field; an undecodable body is a single error.
+func (pr *PoliteRequest) RequireJSONFields(fields ...string) (map[string]interface{}, []error) {
+	m, err := pr.JSONParams()
+	if err != nil {
+		return nil, []error{errors.New("invalid JSON body: " + err.Error())}
+	}
+
+	var errs []error
+
+	for _, f := range fields {
+		if v, ok := m[f]; !ok || v == nil || v == "" {
+			errs = append(errs, errors.New("parameter '"+f+"' is required"))
+		}
+	}
+
+	return m, errs
+}
+
+// replayBody is a request body already read by RawBody.
+type replayBody struct {
+	*bytes.Reader
+	raw []byte
+}
+
+func (replayBody) Close() error {
+	return nil
+}
+
+// RawBody reads the whole body and returns it, e.g. to verify a webhook
+// signature, leaving the body in place to be read again: JSONParams, BindJSON
+// and FormParams still work afterwards. Later calls return the same bytes.
+// The body size limit applies, see SetMaxBodySize.
+func (pr *PoliteRequest) RawBody() ([]byte, error) {
+	if rb, ok := pr.Body.(*replayBody); ok {
+		pr.Body = &replayBody{Reader: bytes.NewReader(rb.raw), raw: rb.raw}
+		return rb.raw, nil
+	}
+
+	if pr.Body == nil || pr.Body == http.NoBody {
+		return nil, nil
+	}
+
+	raw, err := io.ReadAll(pr.Body)
+	pr.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	pr.Body = &replayBody{Reader: bytes.NewReader(raw), raw: raw}
+	return raw, nil
+}
+
+// BindJSON decodes a JSON body into v, which must be a pointer.
+// Fields of the body that v has no place for are ignored.
+func (pr *PoliteRequest) BindJSON(v interface{}) error {
+	return pr.bindJSON(v, false)
+}
+
+// BindJSONStrict is like BindJSON but fails if the body contains fields
+// that v has no place for.
+func (pr *PoliteRequest) BindJSONStrict(v interface{}) error {
+	return pr.bindJSON(v, true)
+}
+
+func (pr *PoliteRequest) bindJSON(v interface{}, strict bool) error {
+	defer pr.Body.Close()
+	decoder := json.NewDecoder(pr.Body)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		if err == io.EOF {
+			return ErrEmptyBody
+		}
+		return appendBodyError(err)
+	}
+	return nil
+}
+
+// appendBodyError wraps err as utility.AppendError does, except for an
+// *http.MaxBytesError, returned as it is so that it still answers 413.
+func appendBodyError(err error) error {
+	var mbe *http.MaxBytesError
+
+	if errors.As(err, &mbe) {
+		return err
+	}
+	return utility.AppendError(err)
+}
+
 // MultipartParams parses a multipart/form-data request and returns:
 // - fields: map[string]string of form field values
 // - files: map[string][]*multipart.FileHeader of uploaded files
@@ -110,6 +400,62 @@ func (pr PoliteRequest) RetrieveMultipartFileBytes(key string) (buf []byte, h *m
 	}
 
 	buf = buffer.Bytes()
-	err = utility.AppendError(err)
+	err = appendBodyError(err)
 	return
 }
+
+// ErrNoMultipartFile is returned by SaveMultipartFileProgress when the
+// request has no file part with the given key.
+var ErrNoMultipartFile = errors.New("no such multipart file")
+
+// progressReader counts the bytes read through it, reporting them to cb.
+type progressReader struct {
+	r     io.Reader
+	read  int64
+	total int64
+	cb    func(read, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		if p.cb != nil {
+			p.cb(p.read, p.total)
+		}
+	}
+	return n, err
+}
+
+// SaveMultipartFileProgress streams the file part key of a multipart request
+// to dest without buffering the whole form, calling cb after each chunk with
+// the bytes of the file read so far and the total. The total is the request
+// Content-Length, which also counts the other parts, or -1 if unknown.
+// It returns the number of bytes written. The form must not have been parsed
+// already, e.g. by MultipartParams.
+func (pr *PoliteRequest) SaveMultipartFileProgress(key string, dest io.Writer, cb func(read, total int64)) (int64, error) {
+	mr, err := pr.MultipartReader()
+	if err != nil {
+		return 0, appendBodyError(err)
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return 0, ErrNoMultipartFile
+		} else if err != nil {
+			return 0, appendBodyError(err)
+		}
+
+		if part.FormName() != key || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		defer part.Close()
+
+		src := &progressReader{r: part, total: pr.ContentLength, cb: cb}
+		n, err := io.CopyBuffer(dest, src, make([]byte, 32<<10))
+		return n, appendBodyError(err)
+	}
+}
@@ -4,10 +4,16 @@
 package goapi
 
 import (
+	"encoding/json"
 	"errors"
+	"mime"
+	"net/mail"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // PostFieldType defines supported POST parameter data types for validation.
@@ -23,17 +29,64 @@ const (
 	DATE       // yyyy-mm-dd
 	TIME       // hh:mm:ss
 	DATETIME   // yyyy-mm-dd hh:mm:ss
+	EMAIL      // bare address, e.g. user@example.com
+	URL        // absolute URL, e.g. https://example.com/path
+	UUID       // xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, hexadecimal
 )
 
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 type PostParam struct {
 	Name     string        // parameter name
 	Type     PostFieldType // expected data type
 	Required bool          // whether the parameter is mandatory
+
+	regex  *regexp.Regexp     // pattern the value must match, if any
+	custom func(string) error // custom validator, if any
+
+	minLen, maxLen *int     // length bounds, in characters, if any
+	min, max       *float64 // numeric bounds, if any
+}
+
+// AssertOption sets an optional constraint on a parameter.
+type AssertOption func(p *PostParam)
+
+// MinLen requires the value to be at least n characters long.
+func MinLen(n int) AssertOption {
+	return func(p *PostParam) { p.minLen = &n }
+}
+
+// MaxLen requires the value to be at most n characters long.
+func MaxLen(n int) AssertOption {
+	return func(p *PostParam) { p.maxLen = &n }
+}
+
+// Min requires the value to be >= f. It applies to numeric types only.
+func Min(f float64) AssertOption {
+	return func(p *PostParam) { p.min = &f }
+}
+
+// Max requires the value to be <= f. It applies to numeric types only.
+func Max(f float64) AssertOption {
+	return func(p *PostParam) { p.max = &f }
+}
+
+// isNumeric reports whether values of the type are numbers.
+func (t PostFieldType) isNumeric() bool {
+	switch t {
+	case INTEGER, FLOAT, POSITIVE_INTEGER, POSITIVE_FLOAT, PERC_FLOAT:
+		return true
+	}
+	return false
 }
 
 type PostAssert struct {
 	pr     PoliteRequest
 	params []PostParam
+
+	jsonBody    map[string]interface{} // decoded body of JSON requests
+	jsonDecoded bool
+	jsonErr     error
 }
 
 func InitPoliteRequestPostInterface(pr PoliteRequest) *PostAssert {
@@ -44,55 +97,205 @@ func (pa *PostAssert) AddParameter(name string, typ PostFieldType, required bool
 	pa.params = append(pa.params, PostParam{Name: name, Type: typ, Required: required})
 }
 
+// AddParameterWithBounds is like AddParameter, with additional constraints
+// checked once the value is known to be of the right type.
+func (pa *PostAssert) AddParameterWithBounds(name string, typ PostFieldType, required bool, opts ...AssertOption) {
+	p := PostParam{Name: name, Type: typ, Required: required}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	pa.params = append(pa.params, p)
+}
+
+// AddRegex adds a string parameter whose value must match pattern.
+// The pattern is compiled once, here; an invalid pattern panics.
+func (pa *PostAssert) AddRegex(name, pattern string, required bool) {
+	pa.params = append(pa.params, PostParam{Name: name, Type: STRING, Required: required, regex: regexp.MustCompile(pattern)})
+}
+
+// AddCustom adds a string parameter validated by fn; the error fn returns, if
+// any, is reported as the reason the value is invalid.
+func (pa *PostAssert) AddCustom(name string, required bool, fn func(string) error) {
+	pa.params = append(pa.params, PostParam{Name: name, Type: STRING, Required: required, custom: fn})
+}
+
+// Assert validates the parameters, reading them from the form values or, if
+// the request Content-Type is JSON, from the top-level fields of the body. A
+// form with more parameters than allowed by SetMaxParams is reported as
+// ErrTooManyParams.
 func (pa *PostAssert) Assert() ([]error, bool) {
 	errs := make([]error, 0)
-	for _, p := range pa.params {
-		val := strings.TrimSpace(pa.pr.PostFormValue(p.Name))
-
-		// Check presence
-		if val == "" {
-			if p.Required {
-				errs = append(errs, errors.New("parameter '"+p.Name+"' is required"))
-			}
-			continue
-		}
-
-		switch p.Type {
-		case STRING:
-			// always valid
-		case INTEGER:
-			if _, err := strconv.Atoi(val); err != nil {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected integer"))
-			}
-		case FLOAT:
-			if _, err := strconv.ParseFloat(val, 64); err != nil {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected float"))
-			}
-		case POSITIVE_INTEGER:
-			if i, err := strconv.Atoi(val); err != nil || i <= 0 {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected positive integer"))
-			}
-		case POSITIVE_FLOAT:
-			if f, err := strconv.ParseFloat(val, 64); err != nil || f <= 0 {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected positive float"))
-			}
-		case PERC_FLOAT:
-			if f, err := strconv.ParseFloat(val, 64); err != nil || f < 0 || f > 1 {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected percentage between 0 and 1"))
-			}
-		case DATE:
-			if _, err := time.Parse("2006-01-02", val); err != nil {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected date in yyyy-mm-dd format"))
-			}
-		case TIME:
-			if _, err := time.Parse("15:04:05", val); err != nil {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected time in hh:mm:ss format"))
-			}
-		case DATETIME:
-			if _, err := time.Parse("2006-01-02 15:04:05", val); err != nil {
-				errs = append(errs, errors.New("parameter '"+p.Name+"': expected datetime in yyyy-mm-dd hh:mm:ss format"))
-			}
+
+	if pa.isJSON() {
+		if _, err := pa.JSON(); err != nil {
+			return append(errs, errors.New("invalid JSON body: "+err.Error())), false
 		}
+	} else if err := pa.pr.checkFormParamCount(); err != nil {
+		return append(errs, err), false
+	}
+
+	for _, p := range pa.params {
+		errs = append(errs, p.check(pa.value(p.Name))...)
 	}
 	return errs, len(errs) == 0
 }
+
+// AssertFields is like Assert, but keys the error messages by parameter name
+// so that they can be shown next to the offending input. The messages of each
+// parameter are in the order its rules are checked. An invalid JSON body, or
+// a form with more parameters than allowed by SetMaxParams, is reported under
+// the "_body" key.
+func (pa *PostAssert) AssertFields() (map[string][]string, bool) {
+	fields := make(map[string][]string)
+
+	if pa.isJSON() {
+		if _, err := pa.JSON(); err != nil {
+			fields["_body"] = []string{"invalid JSON body: " + err.Error()}
+			return fields, false
+		}
+	} else if err := pa.pr.checkFormParamCount(); err != nil {
+		fields["_body"] = []string{err.Error()}
+		return fields, false
+	}
+
+	for _, p := range pa.params {
+		for _, err := range p.check(pa.value(p.Name)) {
+			msg := strings.TrimPrefix(err.Error(), "parameter '"+p.Name+"'")
+			msg = strings.TrimPrefix(strings.TrimPrefix(msg, ":"), " ")
+			fields[p.Name] = append(fields[p.Name], msg)
+		}
+	}
+	return fields, len(fields) == 0
+}
+
+// isJSON reports whether the request body is JSON.
+func (pa *PostAssert) isJSON() bool {
+	mt, _, _ := mime.ParseMediaType(pa.pr.Header.Get("Content-Type"))
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// JSON returns the decoded body of a JSON request. The body is read once, by
+// Assert or by the first call: use this to get the values afterwards.
+func (pa *PostAssert) JSON() (map[string]interface{}, error) {
+	if !pa.jsonDecoded {
+		pa.jsonBody, pa.jsonErr = pa.pr.JSONParams()
+		pa.jsonDecoded = true
+	}
+	return pa.jsonBody, pa.jsonErr
+}
+
+// value returns the trimmed value of the parameter name as a string; JSON
+// numbers and booleans are formatted as they would be in a form.
+func (pa *PostAssert) value(name string) string {
+	if !pa.isJSON() {
+		return strings.TrimSpace(pa.pr.PostFormValue(name))
+	}
+
+	switch v := pa.jsonBody[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// check validates the value of the parameter: presence, type, then any bound,
+// pattern or custom validator.
+func (p *PostParam) check(val string) (errs []error) {
+	// Check presence
+	if val == "" {
+		if p.Required {
+			errs = append(errs, errors.New("parameter '"+p.Name+"' is required"))
+		}
+		return
+	}
+
+	var num float64
+	var err error
+
+	switch p.Type {
+	case STRING:
+		// always valid
+	case INTEGER:
+		var i int
+		if i, err = strconv.Atoi(val); err != nil {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected integer"))
+		}
+		num = float64(i)
+	case FLOAT:
+		if num, err = strconv.ParseFloat(val, 64); err != nil {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected float"))
+		}
+	case POSITIVE_INTEGER:
+		var i int
+		if i, err = strconv.Atoi(val); err != nil || i <= 0 {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected positive integer"))
+		}
+		num = float64(i)
+	case POSITIVE_FLOAT:
+		if num, err = strconv.ParseFloat(val, 64); err != nil || num <= 0 {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected positive float"))
+		}
+	case PERC_FLOAT:
+		if num, err = strconv.ParseFloat(val, 64); err != nil || num < 0 || num > 1 {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected percentage between 0 and 1"))
+		}
+	case DATE:
+		if _, err = time.Parse("2006-01-02", val); err != nil {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected date in yyyy-mm-dd format"))
+		}
+	case TIME:
+		if _, err = time.Parse("15:04:05", val); err != nil {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected time in hh:mm:ss format"))
+		}
+	case DATETIME:
+		if _, err = time.Parse("2006-01-02 15:04:05", val); err != nil {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected datetime in yyyy-mm-dd hh:mm:ss format"))
+		}
+	case EMAIL:
+		if addr, err := mail.ParseAddress(val); err != nil || addr.Address != val {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected email address"))
+		}
+	case URL:
+		if u, err := url.ParseRequestURI(val); err != nil || u.Scheme == "" {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected absolute URL"))
+		}
+	case UUID:
+		if !uuidRegex.MatchString(val) {
+			return append(errs, errors.New("parameter '"+p.Name+"': expected UUID"))
+		}
+	}
+
+	if n := utf8.RuneCountInString(val); p.minLen != nil && n < *p.minLen {
+		errs = append(errs, errors.New("parameter '"+p.Name+"': must be at least "+strconv.Itoa(*p.minLen)+" characters long"))
+	} else if p.maxLen != nil && n > *p.maxLen {
+		errs = append(errs, errors.New("parameter '"+p.Name+"': must be at most "+strconv.Itoa(*p.maxLen)+" characters long"))
+	}
+
+	if p.Type.isNumeric() {
+		if p.min != nil && num < *p.min {
+			errs = append(errs, errors.New("parameter '"+p.Name+"': must be >= "+strconv.FormatFloat(*p.min, 'f', -1, 64)))
+		} else if p.max != nil && num > *p.max {
+			errs = append(errs, errors.New("parameter '"+p.Name+"': must be <= "+strconv.FormatFloat(*p.max, 'f', -1, 64)))
+		}
+	}
+
+	if p.regex != nil && !p.regex.MatchString(val) {
+		errs = append(errs, errors.New("parameter '"+p.Name+"': expected value matching "+p.regex.String()))
+	}
+
+	if p.custom != nil {
+		if err = p.custom(val); err != nil {
+			errs = append(errs, errors.New("parameter '"+p.Name+"': "+err.Error()))
+		}
+	}
+
+	return
+}
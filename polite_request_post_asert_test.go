@@ -0,0 +1,226 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formAssert returns a PostAssert over a form POST carrying values.
+func formAssert(values url.Values) *PostAssert {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return InitPoliteRequestPostInterface(PoliteRequest{Request: r})
+}
+
+// jsonAssert returns a PostAssert over a JSON POST with body.
+func jsonAssert(body string) *PostAssert {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return InitPoliteRequestPostInterface(PoliteRequest{Request: r})
+}
+
+func errorStrings(errs []error) []string {
+	s := make([]string, len(errs))
+	for i, err := range errs {
+		s[i] = err.Error()
+	}
+	return s
+}
+
+func TestPostAssertTypes(t *testing.T) {
+	tests := []struct {
+		typ   PostFieldType
+		good  string
+		bad   string
+		error string
+	}{
+		{STRING, "anything", "", "parameter 'p' is required"},
+		{INTEGER, "-12", "1.5", "parameter 'p': expected integer"},
+		{FLOAT, "-1.5", "abc", "parameter 'p': expected float"},
+		{POSITIVE_INTEGER, "3", "0", "parameter 'p': expected positive integer"},
+		{POSITIVE_FLOAT, "0.1", "-0.1", "parameter 'p': expected positive float"},
+		{PERC_FLOAT, "0.25", "1.5", "parameter 'p': expected percentage between 0 and 1"},
+		{DATE, "2025-02-28", "2025-02-30", "parameter 'p': expected date in yyyy-mm-dd format"},
+		{TIME, "23:59:59", "24:00:00", "parameter 'p': expected time in hh:mm:ss format"},
+		{DATETIME, "2025-02-28 10:00:00", "2025-02-28T10:00:00", "parameter 'p': expected datetime in yyyy-mm-dd hh:mm:ss format"},
+		{EMAIL, "user@example.com", "User <user@example.com>", "parameter 'p': expected email address"},
+		{URL, "https://example.com/path", "/relative/path", "parameter 'p': expected absolute URL"},
+		{UUID, "123e4567-e89b-12d3-a456-426614174000", "123e4567-e89b-12d3-a456", "parameter 'p': expected UUID"},
+	}
+
+	for _, tt := range tests {
+		pa := formAssert(url.Values{"p": {tt.good}})
+		pa.AddParameter("p", tt.typ, true)
+		if errs, ok := pa.Assert(); !ok {
+			t.Errorf("type %d, %q: errors %v", tt.typ, tt.good, errs)
+		}
+
+		pa = formAssert(url.Values{"p": {tt.bad}})
+		pa.AddParameter("p", tt.typ, true)
+		errs, ok := pa.Assert()
+		if ok || !reflect.DeepEqual(errorStrings(errs), []string{tt.error}) {
+			t.Errorf("type %d, %q: errors %q, want %q", tt.typ, tt.bad, errs, tt.error)
+		}
+	}
+}
+
+func TestPostAssertOptional(t *testing.T) {
+	pa := formAssert(url.Values{})
+	pa.AddParameter("p", INTEGER, false)
+
+	if errs, ok := pa.Assert(); !ok {
+		t.Errorf("missing optional parameter: errors %v", errs)
+	}
+}
+
+func TestPostAssertBounds(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   PostFieldType
+		opt   AssertOption
+		value string
+		error string
+	}{
+		{"min length ok", STRING, MinLen(3), "abc", ""},
+		{"min length", STRING, MinLen(3), "ab", "parameter 'p': must be at least 3 characters long"},
+		{"max length ok", STRING, MaxLen(3), "àèì", ""}, // counted in characters, not bytes
+		{"max length", STRING, MaxLen(3), "abcd", "parameter 'p': must be at most 3 characters long"},
+		{"min ok", INTEGER, Min(10), "10", ""},
+		{"min", INTEGER, Min(10), "9", "parameter 'p': must be >= 10"},
+		{"max ok", FLOAT, Max(2.5), "2.5", ""},
+		{"max", FLOAT, Max(2.5), "2.6", "parameter 'p': must be <= 2.5"},
+		{"numeric bound on a string", STRING, Min(10), "1", ""},
+		{"bound after type", INTEGER, Min(10), "x", "parameter 'p': expected integer"},
+	}
+
+	for _, tt := range tests {
+		pa := formAssert(url.Values{"p": {tt.value}})
+		pa.AddParameterWithBounds("p", tt.typ, true, tt.opt)
+
+		want := []string{}
+		if tt.error != "" {
+			want = append(want, tt.error)
+		}
+
+		if errs, _ := pa.Assert(); !reflect.DeepEqual(errorStrings(errs), want) {
+			t.Errorf("%s: errors %q, want %q", tt.name, errs, want)
+		}
+	}
+}
+
+func TestPostAssertRegexAndCustom(t *testing.T) {
+	even := func(v string) error {
+		if (v[len(v)-1]-'0')%2 != 0 {
+			return errors.New("must be even")
+		}
+		return nil
+	}
+
+	pa := formAssert(url.Values{"code": {"AB12"}, "n": {"4"}})
+	pa.AddRegex("code", `^[A-Z]{2}[0-9]{2}$`, true)
+	pa.AddCustom("n", true, even)
+
+	if errs, ok := pa.Assert(); !ok {
+		t.Errorf("valid values: errors %v", errs)
+	}
+
+	pa = formAssert(url.Values{"code": {"ab12"}, "n": {"3"}})
+	pa.AddRegex("code", `^[A-Z]{2}[0-9]{2}$`, true)
+	pa.AddCustom("n", true, even)
+
+	want := []string{
+		"parameter 'code': expected value matching ^[A-Z]{2}[0-9]{2}$",
+		"parameter 'n': must be even",
+	}
+	if errs, _ := pa.Assert(); !reflect.DeepEqual(errorStrings(errs), want) {
+		t.Errorf("invalid values: errors %q, want %q", errs, want)
+	}
+}
+
+func TestPostAssertJSONBody(t *testing.T) {
+	pa := jsonAssert(`{"name":" alice ","age":30,"admin":true,"tags":["a"]}`)
+	pa.AddParameterWithBounds("name", STRING, true, MaxLen(5)) // trimmed before checking
+	pa.AddParameterWithBounds("age", POSITIVE_INTEGER, true, Max(120))
+	pa.AddCustom("admin", true, func(v string) error {
+		if v != "true" {
+			return errors.New("got " + v)
+		}
+		return nil
+	})
+	pa.AddCustom("tags", true, func(v string) error {
+		if v != `["a"]` {
+			return errors.New("got " + v)
+		}
+		return nil
+	})
+
+	if errs, ok := pa.Assert(); !ok {
+		t.Errorf("valid body: errors %v", errs)
+	}
+	if body, err := pa.JSON(); err != nil || body["age"] != float64(30) {
+		t.Errorf("JSON: %v, %v", body, err)
+	}
+
+	pa = jsonAssert(`{"age":"old","name":null}`)
+	pa.AddParameter("name", STRING, true)
+	pa.AddParameter("age", INTEGER, true)
+
+	want := []string{"parameter 'name' is required", "parameter 'age': expected integer"}
+	if errs, _ := pa.Assert(); !reflect.DeepEqual(errorStrings(errs), want) {
+		t.Errorf("invalid body: errors %q, want %q", errs, want)
+	}
+
+	pa = jsonAssert(`{"name":`)
+	pa.AddParameter("name", STRING, true)
+
+	if errs, ok := pa.Assert(); ok || len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "invalid JSON body: ") {
+		t.Errorf("malformed body: errors %q", errs)
+	}
+}
+
+func TestPostAssertFields(t *testing.T) {
+	notAdmin := func(v string) error {
+		if strings.Contains(v, "admin") {
+			return errors.New("is reserved")
+		}
+		return nil
+	}
+
+	pa := formAssert(url.Values{"user": {"admin!"}, "age": {"abc"}})
+	pa.AddParameterWithBounds("user", STRING, true, MaxLen(5))
+	pa.AddRegex("user", `^[a-z]+$`, true)
+	pa.AddCustom("user", true, notAdmin)
+	pa.AddParameter("age", INTEGER, true)
+	pa.AddParameter("email", EMAIL, true)
+	pa.AddParameter("note", STRING, false)
+
+	fields, ok := pa.AssertFields()
+	if ok {
+		t.Fatal("invalid form accepted")
+	}
+
+	want := map[string][]string{
+		"user":  {"must be at most 5 characters long", "expected value matching ^[a-z]+$", "is reserved"},
+		"age":   {"expected integer"},
+		"email": {"is required"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields %q, want %q", fields, want)
+	}
+
+	pa = jsonAssert(`[1,`)
+	pa.AddParameter("user", STRING, true)
+
+	fields, ok = pa.AssertFields()
+	if ok || len(fields) != 1 || len(fields["_body"]) != 1 || !strings.HasPrefix(fields["_body"][0], "invalid JSON body: ") {
+		t.Errorf("malformed body: fields %q, want a single _body error", fields)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type formController struct{}
+
+func (formController) SubmitPost(s *Session, pr PoliteRequest) (string, error) {
+	if _, err := pr.FormParams(); err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
+
+type formRoot struct {
+	Form formController `controller:"true" public:"true"`
+}
+
+// formBody encodes n fields named f0, f1, ...
+func formBody(n int) string {
+	v := url.Values{}
+	for i := 0; i < n; i++ {
+		v.Set("f"+strconv.Itoa(i), "x")
+	}
+	return v.Encode()
+}
+
+func TestMaxParams(t *testing.T) {
+	SetMaxParams(3)
+	t.Cleanup(func() { SetMaxParams(1000) })
+
+	tests := []struct {
+		name   string
+		query  string
+		fields int
+		status int
+	}{
+		{"within limits", "?a=1", 3, http.StatusOK},
+		{"too many fields", "", 4, http.StatusBadRequest},
+		{"too many query parameters", "?a=1&b=2&c=3&d=4", 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/Form/Submit"+tt.query, strings.NewReader(formBody(tt.fields)))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if w := serve(formRoot{}, r); w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+// multipartRequest builds a multipart POST with a text field and a file part
+// named file holding content.
+func multipartRequest(t *testing.T, target string, content []byte) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	if err := mw.WriteField("title", "report"); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile("file", "report.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, target, body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestSaveMultipartFileProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 20000)
+	pr := PoliteRequest{Request: multipartRequest(t, "/", content)}
+
+	var reads []int64
+	var total int64
+
+	dest := &bytes.Buffer{}
+	n, err := pr.SaveMultipartFileProgress("file", dest, func(read, tot int64) {
+		reads = append(reads, read)
+		total = tot
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) || !bytes.Equal(dest.Bytes(), content) {
+		t.Fatalf("saved %d bytes, want %d", n, len(content))
+	}
+
+	if len(reads) < 2 {
+		t.Fatalf("callback called %d times, want one call per chunk", len(reads))
+	}
+	for i := 1; i < len(reads); i++ {
+		if reads[i] <= reads[i-1] {
+			t.Fatalf("progress went from %d to %d", reads[i-1], reads[i])
+		}
+	}
+	if last := reads[len(reads)-1]; last != int64(len(content)) {
+		t.Errorf("last progress %d, want %d", last, len(content))
+	}
+	if total != pr.ContentLength {
+		t.Errorf("total %d, want the Content-Length %d", total, pr.ContentLength)
+	}
+}
+
+func TestSaveMultipartFileProgressMissingPart(t *testing.T) {
+	pr := PoliteRequest{Request: multipartRequest(t, "/", []byte("data"))}
+
+	_, err := pr.SaveMultipartFileProgress("other", io.Discard, func(int64, int64) {})
+	if !errors.Is(err, ErrNoMultipartFile) {
+		t.Errorf("err %v, want ErrNoMultipartFile", err)
+	}
+}
+
+func TestRequireJSONFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		missing []string
+	}{
+		{"all present", `{"name":"x","age":0,"admin":false}`, nil},
+		{"missing", `{"name":"x"}`, []string{"age", "admin"}},
+		{"null", `{"name":null,"age":1,"admin":true}`, []string{"name"}},
+		{"empty string", `{"name":"","age":1,"admin":true}`, []string{"name"}},
+	}
+
+	for _, tt := range tests {
+		pr := PoliteRequest{Request: httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))}
+
+		m, errs := pr.RequireJSONFields("name", "age", "admin")
+		if m == nil {
+			t.Errorf("%s: body not returned", tt.name)
+		}
+
+		if len(errs) != len(tt.missing) {
+			t.Errorf("%s: errors %v, want one for each of %v", tt.name, errs, tt.missing)
+			continue
+		}
+		for i, f := range tt.missing {
+			if !strings.Contains(errs[i].Error(), "'"+f+"'") {
+				t.Errorf("%s: error %q, want it to name %s", tt.name, errs[i], f)
+			}
+		}
+	}
+
+	pr := PoliteRequest{Request: httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":`))}
+	if _, errs := pr.RequireJSONFields("name"); len(errs) != 1 || !strings.Contains(errs[0].Error(), "invalid JSON body") {
+		t.Errorf("malformed body: errors %v", errs)
+	}
+}
+
+type uploadController struct{}
+
+func (uploadController) SendPost(s *Session, pr PoliteRequest) (int, error) {
+	raw, err := pr.RawBody()
+	return len(raw), err
+}
+
+func (uploadController) StreamPost(s *Session, pr PoliteRequest) (int64, error) {
+	return pr.SaveMultipartFileProgress("file", io.Discard, nil)
+}
+
+func (uploadController) BufferPost(s *Session, pr PoliteRequest) (int, error) {
+	buf, _, err := pr.RetrieveMultipartFileBytes("file")
+	return len(buf), err
+}
+
+type uploadRoot struct {
+	Upload uploadController `controller:"true" public:"true"`
+}
+
+func TestMaxBodySize(t *testing.T) {
+	SetMaxBodySize(16)
+	t.Cleanup(func() { SetMaxBodySize(32 << 20) })
+
+	post := func(body string) *httptest.ResponseRecorder {
+		return serve(uploadRoot{}, httptest.NewRequest(http.MethodPost, "/Upload/Send", strings.NewReader(body)))
+	}
+
+	w := post(strings.Repeat("a", 16))
+	if w.Code != http.StatusOK || w.Header().Get("Connection") != "" {
+		t.Errorf("body at the limit: got %d, Connection %q", w.Code, w.Header().Get("Connection"))
+	}
+
+	w = post(strings.Repeat("a", 17))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over the limit: got %d, want 413", w.Code)
+	}
+	if c := w.Header().Get("Connection"); c != "close" {
+		t.Errorf("body over the limit: Connection %q, want close", c)
+	}
+}
+
+func TestMaxBodySizeMultipart(t *testing.T) {
+	SetMaxBodySize(1024)
+	t.Cleanup(func() { SetMaxBodySize(32 << 20) })
+
+	for _, path := range []string{"/Upload/Stream", "/Upload/Buffer"} {
+		if w := serve(uploadRoot{}, multipartRequest(t, path, bytes.Repeat([]byte("a"), 4096))); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: got %d, want 413", path, w.Code)
+		}
+
+		if w := serve(uploadRoot{}, multipartRequest(t, path, []byte("small"))); w.Code != http.StatusOK {
+			t.Errorf("%s within the limit: got %d, want 200", path, w.Code)
+		}
+	}
+}
+
+func TestMaxParamsCheckedBeforeParsing(t *testing.T) {
+	SetMaxParams(3)
+	t.Cleanup(func() { SetMaxParams(1000) })
+
+	newRequest := func(fields int) PoliteRequest {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(formBody(fields)))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return PoliteRequest{Request: r}
+	}
+
+	pr := newRequest(4)
+	if _, err := pr.FormParams(); !errors.Is(err, ErrTooManyParams) {
+		t.Errorf("FormParams: err %v, want ErrTooManyParams", err)
+	}
+	if pr.PostForm != nil {
+		t.Error("FormParams parsed the form before checking the cap")
+	}
+
+	pr = newRequest(4)
+	pa := InitPoliteRequestPostInterface(pr)
+	pa.AddParameter("f0", STRING, true)
+
+	if errs, ok := pa.Assert(); ok || len(errs) != 1 || !errors.Is(errs[0], ErrTooManyParams) {
+		t.Errorf("Assert: errors %v, want ErrTooManyParams", errs)
+	}
+	if pr.PostForm != nil {
+		t.Error("Assert parsed the form before checking the cap")
+	}
+
+	pa = InitPoliteRequestPostInterface(newRequest(4))
+	if fields, ok := pa.AssertFields(); ok || len(fields["_body"]) != 1 {
+		t.Errorf("AssertFields: %v, want the cap reported under _body", fields)
+	}
+
+	pa = InitPoliteRequestPostInterface(newRequest(3))
+	pa.AddParameter("f0", STRING, true)
+	if errs, ok := pa.Assert(); !ok {
+		t.Errorf("within the cap: errors %v", errs)
+	}
+}
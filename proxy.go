@@ -0,0 +1,156 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+var proxyLock = &sync.RWMutex{}
+var trustProxyHeaders = false
+var trustedProxies []*net.IPNet
+
+// TrustProxyHeaders sets whether X-Forwarded-For and X-Real-IP are honored
+// when resolving the client address. Enable it only when the server is
+// reachable exclusively through a proxy that sets them, otherwise clients
+// can spoof their address. If trusted proxies are configured, the headers
+// are honored only on requests coming from them. Disabled by default.
+func TrustProxyHeaders(trust bool) {
+	defer utility.Monitor(proxyLock)()
+	trustProxyHeaders = trust
+}
+
+// SetTrustedProxies sets the addresses, single IPs or CIDR blocks, of the
+// reverse proxies in front of the server. X-Forwarded-Proto and
+// X-Forwarded-Host are honored only on requests coming from them.
+func SetTrustedProxies(proxies ...string) error {
+	nets, err := parseIPNets(proxies)
+	if err != nil {
+		return err
+	}
+
+	defer utility.Monitor(proxyLock)()
+	trustedProxies = nets
+
+	return nil
+}
+
+// parseIPNets parses a list of single IPs and CIDR blocks.
+func parseIPNets(addrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(addrs))
+
+	for _, a := range addrs {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", a)
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, utility.AppendError(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// containsIP reports whether ip lies in any of nets.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func proxyHeadersTrusted(remoteAddr string) bool {
+	defer utility.RMonitor(proxyLock)()
+	return trustProxyHeaders && (len(trustedProxies) == 0 || isTrustedProxy(remoteAddr))
+}
+
+// isTrustedProxy reports whether remoteAddr is a configured proxy.
+// Must be called holding proxyLock.
+func isTrustedProxy(remoteAddr string) bool {
+	ip := net.ParseIP(remoteHost(remoteAddr))
+	return ip != nil && containsIP(trustedProxies, ip)
+}
+
+func fromTrustedProxy(remoteAddr string) bool {
+	defer utility.RMonitor(proxyLock)()
+	return isTrustedProxy(remoteAddr)
+}
+
+// ClientIP returns the address of the client that issued the request.
+// If proxy headers are trusted, the first public address in X-Forwarded-For
+// is used, then X-Real-IP; otherwise, or if neither is usable, the host
+// part of RemoteAddr.
+func (pr *PoliteRequest) ClientIP() string {
+	if proxyHeadersTrusted(pr.RemoteAddr) {
+		forwarded := strings.Join(pr.Header.Values("X-Forwarded-For"), ",")
+
+		for _, part := range strings.Split(forwarded, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(part)); ip != nil && !isPrivateIP(ip) {
+				return ip.String()
+			}
+		}
+
+		if ip := net.ParseIP(strings.TrimSpace(pr.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+	}
+
+	return remoteHost(pr.RemoteAddr)
+}
+
+// ExternalURL returns the URL of the request as the client issued it.
+// Scheme and host come from the connection, unless the request was
+// forwarded by a trusted proxy: then X-Forwarded-Proto and X-Forwarded-Host
+// are used.
+func (pr *PoliteRequest) ExternalURL() *url.URL {
+	u := *pr.URL
+	u.Scheme = "http"
+	u.Host = pr.Host
+
+	if pr.TLS != nil {
+		u.Scheme = "https"
+	}
+
+	if fromTrustedProxy(pr.RemoteAddr) {
+		proto := strings.TrimSpace(strings.Split(pr.Header.Get("X-Forwarded-Proto"), ",")[0])
+		if proto == "http" || proto == "https" {
+			u.Scheme = proto
+		}
+
+		if host := strings.TrimSpace(strings.Split(pr.Header.Get("X-Forwarded-Host"), ",")[0]); host != "" {
+			u.Host = host
+		}
+	}
+
+	return &u
+}
+
+// remoteHost strips the port from a host:port address, IPv6 included.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
@@ -0,0 +1,37 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternalURL(t *testing.T) {
+	if err := SetTrustedProxies("10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxies() })
+
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.0.0.1:4321", "https://example.com/a?b=c"},     // trusted proxy
+		{"203.0.113.7:4321", "http://internal:8080/a?b=c"}, // headers ignored
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://internal:8080/a?b=c", nil)
+		r.RemoteAddr = tt.remoteAddr
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "example.com")
+
+		pr := initPoliteRequest(r)
+		if got := pr.ExternalURL().String(); got != tt.want {
+			t.Errorf("from %s: got %s, want %s", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
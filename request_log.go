@@ -0,0 +1,116 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// RequestLog describes a completed request.
+type RequestLog struct {
+	Time      time.Time // when the request was received
+	Method    string
+	Path      string
+	Route     string // handler that served the request, e.g. "Users.ListGet"; "" for static files
+	Status    int
+	Bytes     int64 // body bytes written
+	Duration  time.Duration
+	RequestID string // see WithRequestID
+	User      string // session user, if any
+}
+
+var requestLoggerLock = &sync.RWMutex{}
+var requestLogger func(RequestLog)
+
+// SetRequestLogger sets fn to receive a RequestLog after each request, e.g. to
+// ship it to a log pipeline. By default a line is logged at INFO level; a nil
+// fn restores the default.
+func SetRequestLogger(fn func(RequestLog)) {
+	defer utility.Monitor(requestLoggerLock)()
+	requestLogger = fn
+}
+
+func getRequestLogger() func(RequestLog) {
+	defer utility.RMonitor(requestLoggerLock)()
+
+	if requestLogger == nil {
+		return defaultRequestLogger
+	}
+
+	return requestLogger
+}
+
+func defaultRequestLogger(l RequestLog) {
+	route, user, id := l.Route, l.User, l.RequestID
+
+	if route == "" {
+		route = "-"
+	}
+	if user == "" {
+		user = "-"
+	}
+	if id == "" {
+		id = "-"
+	}
+
+	utility.Logf(utility.INFO, "%s %s %d %dB %v route=%s user=%s id=%s",
+		l.Method, l.Path, l.Status, l.Bytes, l.Duration.Round(time.Microsecond), route, user, id)
+}
+
+type requestLogKey struct{}
+
+// withRequestLog attaches an empty RequestLog to r, to be completed during
+// dispatch.
+func withRequestLog(r *http.Request) (*http.Request, *RequestLog) {
+	l := &RequestLog{
+		Time:      time.Now(),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: requestID(r),
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestLogKey{}, l)), l
+}
+
+func requestLogFrom(ctx context.Context) *RequestLog {
+	l, _ := ctx.Value(requestLogKey{}).(*RequestLog)
+	return l
+}
+
+// statusRecorder records the status and the body size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
@@ -4,9 +4,24 @@
 package goapi
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"maps"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
 )
 
 // Response is the base interface for all HTTP responses.
@@ -17,8 +32,22 @@ type Response interface {
 
 // BaseResponse provides common functionality for building HTTP responses.
 type BaseResponse struct {
-	headers map[string]string
-	status  int
+	headers   map[string]string
+	status    int
+	statusSet bool // status set with SetStatus rather than left at the default
+	cookies   []*http.Cookie
+	request   *http.Request // request being answered, if bound
+}
+
+// statusResponse is implemented by responses that embed *BaseResponse.
+type statusResponse interface {
+	SetStatus(code int)
+	hasStatus() bool
+}
+
+// requestBinder is implemented by responses that embed *BaseResponse.
+type requestBinder interface {
+	bindRequest(r *http.Request)
 }
 
 // newBaseResponse initializes a BaseResponse with default status 200 OK.
@@ -40,6 +69,40 @@ func (b *BaseResponse) SetHeader(key, value string) {
 // SetStatus sets the HTTP status code for the response.
 func (b *BaseResponse) SetStatus(code int) {
 	b.status = code
+	b.statusSet = true
+}
+
+// AddCookie adds a Set-Cookie header for c to the response.
+func (b *BaseResponse) AddCookie(c *http.Cookie) {
+	b.cookies = append(b.cookies, c)
+}
+
+// SetCookieValue adds a cookie for the whole site, HttpOnly, SameSite=Lax and
+// Secure as configured for the session cookie. maxAge is in seconds; a
+// negative value deletes the cookie.
+func (b *BaseResponse) SetCookieValue(name, value string, maxAge int) {
+	b.AddCookie(&http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   getCookieConfig().Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// hasStatus reports whether the status was set explicitly with SetStatus.
+func (b *BaseResponse) hasStatus() bool {
+	return b.statusSet
+}
+
+// bindRequest makes the request being answered available to Write.
+// handleRequest calls it before writing the response.
+func (b *BaseResponse) bindRequest(r *http.Request) {
+	if b != nil {
+		b.request = r
+	}
 }
 
 // apply writes headers and status code to the writer.
@@ -47,6 +110,9 @@ func (b *BaseResponse) apply(w http.ResponseWriter) {
 	for k, v := range b.headers {
 		w.Header().Set(k, v)
 	}
+	for _, c := range b.cookies {
+		http.SetCookie(w, c)
+	}
 	w.WriteHeader(b.status)
 }
 
@@ -69,6 +135,18 @@ func InitJsonResponse() JsonResponse {
 	return jr
 }
 
+// InitJsonResponseFromError creates a JsonResponse reporting err: its message
+// is appended to the errors and the status is the one err maps to (see
+// StatusCoder). A nil err gives a plain 200 response.
+func InitJsonResponseFromError(err error) JsonResponse {
+	jr := InitJsonResponse()
+	if err != nil {
+		jr.SetStatus(errorStatus(err))
+		jr.AppendError(err)
+	}
+	return jr
+}
+
 // ensure initializes BaseResponse, data map and default fields if they are not yet initialized.
 func (jr *JsonResponse) ensure() {
 	if jr.BaseResponse == nil {
@@ -120,12 +198,101 @@ func (jr *JsonResponse) AppendErrorStr(err string) {
 	jr.data["errors"] = existing
 }
 
+// Data returns a shallow copy of the fields of the JSON body, e.g. to check
+// them in tests without writing the response.
+func (jr *JsonResponse) Data() map[string]interface{} {
+	jr.ensure()
+	return maps.Clone(jr.data)
+}
+
+// HasErrors reports whether any error was appended.
+func (jr *JsonResponse) HasErrors() bool {
+	jr.ensure()
+	errs, _ := jr.data["errors"].([]string)
+	return len(errs) > 0
+}
+
+// SetErrors replaces the errors appended so far with errs.
+func (jr *JsonResponse) SetErrors(errs []string) {
+	jr.ensure()
+	if errs == nil {
+		errs = []string{}
+	}
+	jr.data["errors"] = errs
+}
+
+// AppendFieldErrors merges errors keyed by field name, as returned by
+// PostAssert.AssertFields, into the fieldErrors object of the JSON body.
+func (jr *JsonResponse) AppendFieldErrors(fields map[string][]string) {
+	jr.ensure()
+	existing, _ := jr.data["fieldErrors"].(map[string][]string)
+	if existing == nil {
+		existing = make(map[string][]string)
+	}
+	for name, msgs := range fields {
+		existing[name] = append(existing[name], msgs...)
+	}
+	jr.data["fieldErrors"] = existing
+}
+
+var maxJSONResponseSizeLock = &sync.RWMutex{}
+var maxJSONResponseSize = 0
+
+// SetMaxJSONResponseSize caps the size in bytes of an encoded JsonResponse
+// body: a larger one is logged and replaced by a 500 Internal Server Error, so
+// that an accidentally unbounded result is not sent to the client. The body is
+// still encoded in memory before being measured. The default is 0, no limit.
+// Streaming responses are not affected.
+func SetMaxJSONResponseSize(n int) {
+	defer utility.Monitor(maxJSONResponseSizeLock)()
+	maxJSONResponseSize = n
+}
+
+func getMaxJSONResponseSize() int {
+	defer utility.RMonitor(maxJSONResponseSizeLock)()
+	return maxJSONResponseSize
+}
+
 // Write serializes the JSON body and writes it to the ResponseWriter.
 // Value receiver ensures JsonResponse can be used as a Response.
 func (jr JsonResponse) Write(w http.ResponseWriter) {
 	jr.ensure()
+
+	limit := getMaxJSONResponseSize()
+	if limit <= 0 {
+		jr.apply(w)
+		json.NewEncoder(w).Encode(jr.data)
+		return
+	}
+
+	body, err := json.Marshal(jr.data)
+	msg := "could not encode response"
+	if err == nil && len(body)+1 > limit {
+		err = fmt.Errorf("JSON response of %d bytes exceeds the limit of %d bytes", len(body)+1, limit)
+		msg = "response too large"
+	}
+
+	if err != nil {
+		utility.Logf(utility.ERROR, "%v", utility.AppendError(err))
+
+		// The replacement keeps the headers, cookies and session flag
+		// already set, e.g. a login cookie
+		failed := InitJsonResponse()
+		maps.Copy(failed.headers, jr.headers)
+		failed.cookies = append(failed.cookies, jr.cookies...)
+		failed.data["session"] = jr.data["session"]
+		failed.SetStatus(http.StatusInternalServerError)
+		failed.AppendErrorStr(msg)
+
+		jr = failed
+		body, _ = json.Marshal(jr.data)
+	}
+
+	body = append(body, '\n')
+
+	jr.SetHeader("Content-Length", strconv.Itoa(len(body)))
 	jr.apply(w)
-	json.NewEncoder(w).Encode(jr.data)
+	w.Write(body)
 }
 
 // BlobResponse represents a binary blob HTTP response (e.g., file download).
@@ -137,7 +304,16 @@ type BlobResponse struct {
 }
 
 // InitBlobResponse creates a BlobResponse with content, MIME type, and filename.
+//
+// Deprecated: use InitAttachmentBlobResponse, or InitInlineBlobResponse for
+// content the browser should display.
 func InitBlobResponse(blob []byte, mimeType, fileName string) BlobResponse {
+	return InitAttachmentBlobResponse(blob, mimeType, fileName)
+}
+
+// InitAttachmentBlobResponse creates a BlobResponse downloaded by the browser
+// as fileName.
+func InitAttachmentBlobResponse(blob []byte, mimeType, fileName string) BlobResponse {
 	br := newBaseResponse()
 	br.SetHeader("Content-Type", mimeType)
 	br.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
@@ -149,11 +325,103 @@ func InitBlobResponse(blob []byte, mimeType, fileName string) BlobResponse {
 	}
 }
 
-// Write writes the blob content to the ResponseWriter.
+// InitInlineBlobResponse creates a BlobResponse displayed by the browser, such
+// as a PDF or an image, rather than downloaded.
+func InitInlineBlobResponse(blob []byte, mimeType string) BlobResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", mimeType)
+	br.SetHeader("Content-Disposition", "inline")
+	return BlobResponse{
+		BaseResponse: br,
+		Blob:         blob,
+		MimeType:     mimeType,
+	}
+}
+
+// Write writes the blob content to the ResponseWriter, with its length as
+// Content-Length.
+// If the request carries a single satisfiable Range header, only that slice
+// of the blob is written, with status 206 Partial Content; multiple ranges,
+// unsatisfiable and malformed ones get 416. Accept-Ranges is always sent.
 // Value receiver ensures BlobResponse can be used as a Response.
 func (br BlobResponse) Write(w http.ResponseWriter) {
+	blob := br.Blob
+
+	br.SetHeader("Accept-Ranges", "bytes")
+
+	if br.request != nil && br.status == http.StatusOK {
+		if h := br.request.Header.Get("Range"); h != "" {
+			start, end, err := parseRange(h, len(blob))
+
+			if err == nil {
+				br.SetHeader("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(blob)))
+				br.SetStatus(http.StatusPartialContent)
+				blob = blob[start:end]
+			} else {
+				br.SetHeader("Content-Range", fmt.Sprintf("bytes */%d", len(blob)))
+				br.SetStatus(http.StatusRequestedRangeNotSatisfiable)
+				blob = nil
+			}
+		}
+	}
+
+	br.SetHeader("Content-Length", strconv.Itoa(len(blob)))
 	br.apply(w)
-	w.Write(br.Blob)
+	w.Write(blob)
+}
+
+var errRangeMalformed = errors.New("malformed range")
+var errRangeUnsatisfiable = errors.New("unsatisfiable range")
+
+// parseRange parses a Range header against a body of size bytes and returns
+// the requested slice as [start, end). Only single byte ranges are supported:
+// a list of ranges is reported as unsatisfiable.
+func parseRange(h string, size int) (start, end int, err error) {
+	spec, ok := strings.CutPrefix(h, "bytes=")
+	if !ok {
+		return 0, 0, errRangeMalformed
+	}
+
+	if strings.Contains(spec, ",") {
+		return 0, 0, errRangeUnsatisfiable
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errRangeMalformed
+	}
+
+	if first == "" {
+		// suffix range: the last n bytes
+		n, perr := strconv.Atoi(last)
+		if perr != nil || n < 0 {
+			return 0, 0, errRangeMalformed
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errRangeUnsatisfiable
+		}
+		return max(size-n, 0), size, nil
+	}
+
+	start, perr := strconv.Atoi(first)
+	if perr != nil || start < 0 {
+		return 0, 0, errRangeMalformed
+	}
+
+	end = size
+	if last != "" {
+		l, perr := strconv.Atoi(last)
+		if perr != nil || l < start {
+			return 0, 0, errRangeMalformed
+		}
+		end = min(l+1, size)
+	}
+
+	if start >= size {
+		return 0, 0, errRangeUnsatisfiable
+	}
+
+	return start, end, nil
 }
 
 // RedirectResponse represents an HTTP redirect response.
@@ -178,3 +446,554 @@ func InitRedirectResponse(location string, status int) RedirectResponse {
 func (rr RedirectResponse) Write(w http.ResponseWriter) {
 	rr.apply(w)
 }
+
+// NDJSONResponse streams values as newline-delimited JSON, one value per line.
+type NDJSONResponse struct {
+	*BaseResponse
+	Items <-chan interface{}
+	ctx   context.Context
+}
+
+// InitNDJSONResponse creates an NDJSONResponse writing every value received
+// from items until the channel is closed or ctx (usually the request context)
+// is done. The producer should stop on ctx as well, since nobody will be
+// reading items any more.
+func InitNDJSONResponse(ctx context.Context, items <-chan interface{}) NDJSONResponse {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "application/x-ndjson")
+	return NDJSONResponse{
+		BaseResponse: br,
+		Items:        items,
+		ctx:          ctx,
+	}
+}
+
+// Write encodes each item as soon as it is received, flushing whenever the
+// producer has nothing ready so that clients see lines without delay.
+// Value receiver ensures NDJSONResponse can be used as a Response.
+func (nr NDJSONResponse) Write(w http.ResponseWriter) {
+	nr.apply(w)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for nr.ctx.Err() == nil {
+		var item interface{}
+		var ok bool
+
+		select {
+		case item, ok = <-nr.Items:
+		default:
+			flush()
+			select {
+			case item, ok = <-nr.Items:
+			case <-nr.ctx.Done():
+				return
+			}
+		}
+
+		if !ok {
+			flush()
+			return
+		}
+
+		if err := enc.Encode(item); err != nil {
+			utility.Logf(utility.ERROR, "%v", err)
+			return
+		}
+	}
+}
+
+// StreamResponse represents a download whose content is copied from an
+// io.Reader instead of being held in memory.
+type StreamResponse struct {
+	*BaseResponse
+	Reader   io.Reader
+	MimeType string
+	FileName string
+}
+
+// InitStreamResponse creates a StreamResponse with content, MIME type, and filename.
+// If r is an *os.File or an io.Seeker the Content-Length header is set too.
+// If r is an io.Closer it is closed once written. An empty fileName omits
+// Content-Disposition.
+func InitStreamResponse(r io.Reader, mimeType, fileName string) StreamResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", mimeType)
+	if fileName != "" {
+		br.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	}
+
+	if size, ok := readerSize(r); ok {
+		br.SetHeader("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	return StreamResponse{
+		BaseResponse: br,
+		Reader:       r,
+		MimeType:     mimeType,
+		FileName:     fileName,
+	}
+}
+
+// InitFileStreamResponse creates a StreamResponse streaming the file at path,
+// named after its base name.
+func InitFileStreamResponse(path, mimeType string) (StreamResponse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return StreamResponse{}, utility.AppendError(err)
+	}
+	return InitStreamResponse(f, mimeType, filepath.Base(path)), nil
+}
+
+// readerSize returns the number of bytes left in r, if it can tell.
+func readerSize(r io.Reader) (int64, bool) {
+	if f, ok := r.(*os.File); ok {
+		if st, err := f.Stat(); err == nil && st.Mode().IsRegular() {
+			if pos, err := f.Seek(0, io.SeekCurrent); err == nil {
+				return st.Size() - pos, true
+			}
+		}
+		return 0, false
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		pos, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err = s.Seek(pos, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - pos, true
+	}
+
+	return 0, false
+}
+
+// Write copies the reader to the ResponseWriter in bounded chunks, then
+// closes it if it is an io.Closer, even if the copy fails. Once the copy has
+// started the status can no longer change, so a failure is only logged.
+// Value receiver ensures StreamResponse can be used as a Response.
+func (sr StreamResponse) Write(w http.ResponseWriter) {
+	if sr.Reader == nil {
+		sr.SetHeader("Content-Length", "0")
+		sr.apply(w)
+		return
+	}
+
+	if c, ok := sr.Reader.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				utility.Logf(utility.WARNING, "%v", utility.AppendError(err))
+			}
+		}()
+	}
+
+	sr.apply(w)
+
+	buf := make([]byte, 32<<10)
+	if _, err := io.CopyBuffer(w, sr.Reader, buf); err != nil {
+		utility.Logf(utility.ERROR, "%v", utility.AppendError(err))
+	}
+}
+
+// TemplateResponse represents an HTML page rendered from a template.
+type TemplateResponse struct {
+	*BaseResponse
+	Template *template.Template
+	Name     string
+	Data     interface{}
+
+	err error // error loading the template, if any
+}
+
+var templateCacheLock = &sync.Mutex{}
+var templateCache = make(map[string]*template.Template)
+
+// loadTemplateFile parses the template file at path, once: later calls return
+// the cached template. A file that fails to parse is not cached.
+func loadTemplateFile(path string) (*template.Template, error) {
+	defer utility.Monitor(templateCacheLock)()
+
+	if tmpl, ok := templateCache[path]; ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, utility.AppendError(err)
+	}
+
+	templateCache[path] = tmpl
+	return tmpl, nil
+}
+
+// InitTemplateResponse creates a TemplateResponse executing the template name
+// of tmpl with data. An empty name executes tmpl itself.
+func InitTemplateResponse(tmpl *template.Template, name string, data interface{}) TemplateResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "text/html; charset=utf-8")
+	return TemplateResponse{
+		BaseResponse: br,
+		Template:     tmpl,
+		Name:         name,
+		Data:         data,
+	}
+}
+
+// InitTemplateFileResponse creates a TemplateResponse executing the template
+// file at path with data. The file is parsed on first use and then cached, so
+// changes on disk are not picked up until restart. If the file cannot be
+// parsed, Write answers 500 Internal Server Error.
+func InitTemplateFileResponse(path string, data interface{}) TemplateResponse {
+	tmpl, err := loadTemplateFile(path)
+	tr := InitTemplateResponse(tmpl, "", data)
+	tr.err = err
+	return tr
+}
+
+// Write renders the template into a buffer first, so that an execution error
+// results in a 500 instead of a half-rendered page.
+// Value receiver ensures TemplateResponse can be used as a Response.
+func (tr TemplateResponse) Write(w http.ResponseWriter) {
+	var buf bytes.Buffer
+	var err error
+
+	if tr.err != nil {
+		err = tr.err
+	} else if tr.Template == nil {
+		err = errors.New("nil template")
+	} else if tr.Name == "" {
+		err = tr.Template.Execute(&buf, tr.Data)
+	} else {
+		err = tr.Template.ExecuteTemplate(&buf, tr.Name, tr.Data)
+	}
+
+	if err != nil {
+		utility.Logf(utility.ERROR, "%v", utility.AppendError(err))
+		if tr.request != nil {
+			writeStatus(w, tr.request, http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tr.SetHeader("Content-Length", strconv.Itoa(buf.Len()))
+	tr.apply(w)
+	buf.WriteTo(w)
+}
+
+// CSVResponse represents a CSV download, written with encoding/csv.
+type CSVResponse struct {
+	*BaseResponse
+	FileName string
+	Header   []string
+	Rows     [][]string
+	Stream   <-chan []string // if not nil, rows are read from here after Rows
+	BOM      bool            // prepend a UTF-8 byte order mark, for Excel
+}
+
+// InitCSVResponse creates a CSVResponse with a header row (omitted if nil)
+// and the given rows.
+func InitCSVResponse(fileName string, header []string, rows [][]string) CSVResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "text/csv; charset=utf-8")
+	br.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	return CSVResponse{
+		BaseResponse: br,
+		FileName:     fileName,
+		Header:       header,
+		Rows:         rows,
+	}
+}
+
+// InitCSVStreamResponse creates a CSVResponse writing every row received from
+// rows until the channel is closed or the request is canceled.
+func InitCSVStreamResponse(fileName string, header []string, rows <-chan []string) CSVResponse {
+	cr := InitCSVResponse(fileName, header, nil)
+	cr.Stream = rows
+	return cr
+}
+
+// Write writes the header and the rows, quoting fields as needed.
+// Value receiver ensures CSVResponse can be used as a Response.
+func (cr CSVResponse) Write(w http.ResponseWriter) {
+	cr.apply(w)
+
+	if cr.BOM {
+		w.Write([]byte("\xEF\xBB\xBF"))
+	}
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	if cr.Header != nil {
+		cw.Write(cr.Header)
+	}
+
+	if err := cw.WriteAll(cr.Rows); err != nil {
+		utility.Logf(utility.ERROR, "%v", err)
+		return
+	}
+
+	if cr.Stream == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if cr.request != nil {
+		ctx = cr.request.Context()
+	}
+
+	for {
+		select {
+		case row, ok := <-cr.Stream:
+			if !ok {
+				return
+			}
+			if err := cw.Write(row); err != nil {
+				utility.Logf(utility.ERROR, "%v", err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HTMLResponse represents an HTML page rendered by the handler.
+type HTMLResponse struct {
+	*BaseResponse
+	Body []byte
+}
+
+// InitHTMLResponse creates an HTMLResponse with the given page.
+func InitHTMLResponse(body []byte) HTMLResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "text/html; charset=utf-8")
+	return HTMLResponse{
+		BaseResponse: br,
+		Body:         body,
+	}
+}
+
+// InitHTMLResponseString creates an HTMLResponse with the given page.
+func InitHTMLResponseString(s string) HTMLResponse {
+	return InitHTMLResponse([]byte(s))
+}
+
+// Write writes the page to the ResponseWriter.
+// Value receiver ensures HTMLResponse can be used as a Response.
+func (hr HTMLResponse) Write(w http.ResponseWriter) {
+	hr.SetHeader("Content-Length", strconv.Itoa(len(hr.Body)))
+	hr.apply(w)
+	w.Write(hr.Body)
+}
+
+// PlainTextResponse represents an unformatted text response.
+type PlainTextResponse struct {
+	*BaseResponse
+	Text string
+}
+
+// InitPlainTextResponse creates a PlainTextResponse with the given text.
+func InitPlainTextResponse(text string) PlainTextResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	return PlainTextResponse{
+		BaseResponse: br,
+		Text:         text,
+	}
+}
+
+// Write writes the text to the ResponseWriter.
+// Value receiver ensures PlainTextResponse can be used as a Response.
+func (pr PlainTextResponse) Write(w http.ResponseWriter) {
+	pr.SetHeader("Content-Length", strconv.Itoa(len(pr.Text)))
+	pr.apply(w)
+	io.WriteString(w, pr.Text)
+}
+
+// ReaderResponse is a StreamResponse whose size is given by the caller, for
+// readers that cannot tell it, such as the body of an upstream response.
+type ReaderResponse = StreamResponse
+
+// InitReaderResponse creates a ReaderResponse streaming r as fileName and
+// closing it once written. An empty fileName omits Content-Disposition; a
+// negative size omits Content-Length.
+func InitReaderResponse(r io.ReadCloser, mimeType, fileName string, size int64) ReaderResponse {
+	sr := InitStreamResponse(r, mimeType, fileName)
+
+	if size >= 0 {
+		sr.SetHeader("Content-Length", strconv.FormatInt(size, 10))
+	} else {
+		delete(sr.headers, "Content-Length")
+	}
+
+	return sr
+}
+
+// EmptyResponse represents a response with no body, such as 204 No Content or
+// 304 Not Modified.
+type EmptyResponse struct {
+	*BaseResponse
+}
+
+// InitEmptyResponse creates an EmptyResponse with the given status.
+func InitEmptyResponse(status int) EmptyResponse {
+	br := newBaseResponse()
+	br.SetStatus(status)
+	return EmptyResponse{BaseResponse: br}
+}
+
+// Write writes the headers and the status only.
+// Value receiver ensures EmptyResponse can be used as a Response.
+func (er EmptyResponse) Write(w http.ResponseWriter) {
+	er.apply(w)
+}
+
+// StatusOnlyResponse is an EmptyResponse, for responses such as 201 Created
+// or 202 Accepted that carry nothing but their status and headers.
+type StatusOnlyResponse = EmptyResponse
+
+// InitStatusOnlyResponse creates a StatusOnlyResponse with the given status.
+func InitStatusOnlyResponse(code int) StatusOnlyResponse {
+	return InitEmptyResponse(code)
+}
+
+// XMLResponse represents an XML HTTP response.
+type XMLResponse struct {
+	*BaseResponse
+	Payload interface{}
+}
+
+// InitXMLResponse creates an XMLResponse marshalling payload with encoding/xml.
+func InitXMLResponse(payload interface{}) XMLResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "application/xml")
+	return XMLResponse{
+		BaseResponse: br,
+		Payload:      payload,
+	}
+}
+
+// Write marshals the payload into a buffer first, so that a marshalling error
+// results in a 500 instead of a truncated document.
+// Value receiver ensures XMLResponse can be used as a Response.
+func (xr XMLResponse) Write(w http.ResponseWriter) {
+	var buf bytes.Buffer
+
+	buf.WriteString(xml.Header)
+
+	if err := xml.NewEncoder(&buf).Encode(xr.Payload); err != nil {
+		utility.Logf(utility.ERROR, "%v", utility.AppendError(err))
+		if xr.request != nil {
+			writeStatus(w, xr.request, http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	xr.SetHeader("Content-Length", strconv.Itoa(buf.Len()))
+	xr.apply(w)
+	buf.WriteTo(w)
+}
+
+// SSEEvent is an event pushed by an SSEResponse.
+type SSEEvent struct {
+	ID    string
+	Event string // event type; "message" if empty
+	Data  string
+}
+
+// SSEResponse pushes events to the client as Server-Sent Events.
+type SSEResponse struct {
+	*BaseResponse
+	Events <-chan SSEEvent
+}
+
+// InitSSEResponse creates an SSEResponse writing every event received from
+// events until the channel is closed or the client disconnects.
+func InitSSEResponse(events <-chan SSEEvent) SSEResponse {
+	br := newBaseResponse()
+	br.SetHeader("Content-Type", "text/event-stream")
+	br.SetHeader("Cache-Control", "no-cache")
+	return SSEResponse{
+		BaseResponse: br,
+		Events:       events,
+	}
+}
+
+// Write sends the headers at once, then each event as soon as it is received.
+// Value receiver ensures SSEResponse can be used as a Response.
+func (sr SSEResponse) Write(w http.ResponseWriter) {
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	ctx := context.Background()
+	if sr.request != nil {
+		ctx = sr.request.Context()
+	}
+
+	sr.apply(w)
+	flush()
+
+	for {
+		select {
+		case ev, ok := <-sr.Events:
+			if !ok {
+				return
+			}
+			if _, err := io.WriteString(w, ev.format()); err != nil {
+				utility.Logf(utility.ERROR, "%v", err)
+				return
+			}
+			flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// format renders the event in the text/event-stream format. Multi-line data
+// is sent as several data lines.
+func (ev SSEEvent) format() string {
+	var sb strings.Builder
+
+	if ev.ID != "" {
+		sb.WriteString("id: " + singleLine(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		sb.WriteString("event: " + singleLine(ev.Event) + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(ev.Data, "\r\n", "\n"), "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// singleLine drops line breaks, which would end an SSE field early.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
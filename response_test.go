@@ -0,0 +1,273 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNDJSONResponse(t *testing.T) {
+	items := make(chan interface{}, 3)
+	items <- map[string]int{"n": 1}
+	items <- map[string]int{"n": 2}
+	items <- map[string]int{"n": 3}
+	close(items)
+
+	w := httptest.NewRecorder()
+	InitNDJSONResponse(context.Background(), items).Write(w)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type %q", ct)
+	}
+
+	sc := bufio.NewScanner(w.Body)
+	n := 0
+
+	for sc.Scan() {
+		var v map[string]int
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+			t.Fatalf("line %d does not decode on its own: %v", n+1, err)
+		}
+		if n++; v["n"] != n {
+			t.Errorf("line %d: got %v", n, v)
+		}
+	}
+
+	if n != 3 {
+		t.Errorf("got %d lines, want 3", n)
+	}
+}
+
+func TestNDJSONResponseStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	InitNDJSONResponse(ctx, make(chan interface{})).Write(w)
+
+	if body := strings.TrimSpace(w.Body.String()); body != "" {
+		t.Errorf("wrote %q after the client went away", body)
+	}
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string   { return "no such item" }
+func (notFoundError) StatusCode() int { return http.StatusNotFound }
+
+func TestInitJsonResponseFromError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{nil, http.StatusOK},
+		{errors.New("boom"), http.StatusInternalServerError},
+		{notFoundError{}, http.StatusNotFound},
+		{fmt.Errorf("loading: %w", notFoundError{}), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		jr := InitJsonResponseFromError(tt.err)
+
+		if jr.status != tt.status {
+			t.Errorf("%v: got status %d, want %d", tt.err, jr.status, tt.status)
+		}
+		if jr.HasErrors() != (tt.err != nil) {
+			t.Errorf("%v: errors %v", tt.err, jr.Data()["errors"])
+		}
+	}
+}
+
+func TestJSONResponseSizeGuard(t *testing.T) {
+	SetMaxJSONResponseSize(64)
+	t.Cleanup(func() { SetMaxJSONResponseSize(0) })
+
+	small := InitJsonResponse()
+	small.Set("ok", true)
+
+	w := httptest.NewRecorder()
+	small.Write(w)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("small response: status %d", w.Code)
+	}
+
+	big := InitJsonResponse()
+	big.Set("payload", strings.Repeat("x", 1000))
+
+	w = httptest.NewRecorder()
+	big.Write(w)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("big response: status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "xxx") {
+		t.Error("big response: payload was sent")
+	}
+	if !strings.Contains(w.Body.String(), "response too large") {
+		t.Errorf("big response: body %q", w.Body.String())
+	}
+	if cl := w.Header().Get("Content-Length"); cl != fmt.Sprint(w.Body.Len()) {
+		t.Errorf("Content-Length %q, body %d bytes", cl, w.Body.Len())
+	}
+
+	// The replacement keeps what was set on the original response
+	big = InitJsonResponse()
+	big.SetSession(false)
+	big.SetHeader("X-Trace", "abc")
+	big.SetCookieValue("prefs", "dark", 60)
+	big.Set("payload", strings.Repeat("x", 1000))
+
+	w = httptest.NewRecorder()
+	big.Write(w)
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("X-Trace") != "abc" {
+		t.Errorf("replacement: status %d, X-Trace %q", w.Code, w.Header().Get("X-Trace"))
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Name != "prefs" {
+		t.Errorf("replacement: cookies %v", c)
+	}
+	if !strings.Contains(w.Body.String(), `"session":false`) {
+		t.Errorf("replacement: body %q, want the session flag kept", w.Body.String())
+	}
+}
+
+func TestStatusOnlyResponse(t *testing.T) {
+	resp := InitStatusOnlyResponse(http.StatusCreated)
+	resp.SetHeader("Location", "/items/7")
+	resp.SetCookieValue("last", "7", 60)
+
+	w := httptest.NewRecorder()
+	resp.Write(w)
+
+	if w.Code != http.StatusCreated || w.Body.Len() != 0 {
+		t.Errorf("got %d %q, want an empty 201", w.Code, w.Body.String())
+	}
+	if loc := w.Header().Get("Location"); loc != "/items/7" {
+		t.Errorf("Location %q", loc)
+	}
+	if len(w.Result().Cookies()) != 1 {
+		t.Errorf("cookies %v", w.Result().Cookies())
+	}
+}
+
+// closeRecorder is a reader remembering whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReaderResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		size     int64
+		length   string
+	}{
+		{"known size", "data.bin", 5, "5"},
+		{"unknown size", "", -1, ""},
+	}
+
+	for _, tt := range tests {
+		r := &closeRecorder{Reader: strings.NewReader("hello")}
+
+		w := httptest.NewRecorder()
+		InitReaderResponse(r, "application/octet-stream", tt.fileName, tt.size).Write(w)
+
+		if w.Body.String() != "hello" || !r.closed {
+			t.Errorf("%s: body %q, closed %v", tt.name, w.Body.String(), r.closed)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != tt.length {
+			t.Errorf("%s: Content-Length %q, want %q", tt.name, cl, tt.length)
+		}
+		if cd := w.Header().Get("Content-Disposition"); (cd != "") != (tt.fileName != "") {
+			t.Errorf("%s: Content-Disposition %q", tt.name, cd)
+		}
+	}
+}
+
+func TestStreamResponseSize(t *testing.T) {
+	w := httptest.NewRecorder()
+	InitStreamResponse(bytes.NewReader([]byte("hello")), "text/plain", "a.txt").Write(w)
+
+	if w.Body.String() != "hello" || w.Header().Get("Content-Length") != "5" {
+		t.Errorf("body %q, Content-Length %q", w.Body.String(), w.Header().Get("Content-Length"))
+	}
+}
+
+func TestBlobResponseContentLength(t *testing.T) {
+	blob := []byte("0123456789")
+
+	tests := []struct {
+		name   string
+		rng    string
+		status int
+		length string
+		body   string
+	}{
+		{"full", "", http.StatusOK, "10", "0123456789"},
+		{"range", "bytes=2-5", http.StatusPartialContent, "4", "2345"},
+		{"unsatisfiable", "bytes=20-30", http.StatusRequestedRangeNotSatisfiable, "0", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.rng != "" {
+			r.Header.Set("Range", tt.rng)
+		}
+
+		w := httptest.NewRecorder()
+		writeResponse(InitAttachmentBlobResponse(blob, "text/plain", "digits.txt"), w, r)
+
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != tt.length {
+			t.Errorf("%s: Content-Length %q, want %s", tt.name, cl, tt.length)
+		}
+	}
+}
+
+func TestJsonResponseData(t *testing.T) {
+	jr := InitJsonResponse()
+	jr.Set("name", "alice")
+
+	data := jr.Data()
+	if data["session"] != true || data["name"] != "alice" {
+		t.Errorf("data %v", data)
+	}
+
+	// The copy is detached from the response
+	data["name"] = "mallory"
+	delete(data, "session")
+
+	if again := jr.Data(); again["name"] != "alice" || again["session"] != true {
+		t.Errorf("changing the copy changed the response: %v", again)
+	}
+
+	jr.SetSession(false)
+	if jr.Data()["session"] != false {
+		t.Error("Data does not reflect SetSession")
+	}
+
+	var zero JsonResponse
+	if d := zero.Data(); d["session"] != true {
+		t.Errorf("zero JsonResponse: data %v", d)
+	}
+}
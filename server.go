@@ -0,0 +1,489 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// How long a shutdown waits for in-flight requests to complete.
+const defaultShutdownTimeout = 10 * time.Second
+
+// Server is a go-api server, configured through ServerOption values.
+type Server struct {
+	rootController  interface{}
+	dist            string
+	bind            string
+	cert            string
+	key             string
+	useTLS          bool
+	tlsConfig       *tls.Config
+	redirectAddr    string
+	healthPath      string
+	gzipMinSize     int // negative: no compression
+	gzipSkip        []string
+	requestID       bool
+	panicHandler    func(w http.ResponseWriter, r *http.Request, recovered interface{})
+	notFound        func() Response
+	onError         func(err error) Response
+	sessionDumpPath string
+	shutdownTimeout time.Duration
+	timeouts        Timeouts
+}
+
+// Timeouts bounds how long the server spends on a connection or a request.
+// In Timeouts given to WithTimeouts or ServerConfig, zero fields keep the
+// default and negative fields disable the timeout.
+type Timeouts struct {
+	// ReadHeader bounds reading the request headers, against slowloris
+	// clients. Defaults to 10 seconds.
+	ReadHeader time.Duration
+	// Read bounds reading the whole request, body included. No default:
+	// it would cut off slow uploads.
+	Read time.Duration
+	// Write bounds writing the response, from the end of the request
+	// headers. No default: it would cut off long downloads and streams.
+	Write time.Duration
+	// Idle bounds how long a keep-alive connection waits for the next
+	// request. Defaults to 2 minutes.
+	Idle time.Duration
+	// Handler bounds how long a controller method runs; a request
+	// exceeding it gets 503 Service Unavailable and its context is canceled.
+	// Writing the returned response is not bounded, so streaming responses
+	// (NDJSON, Server-Sent Events, downloads) are not cut off, and static
+	// files are not affected. A controller field, or a marker field named
+	// after the route, can override it with a timeout tag, "0" disabling it:
+	//
+	//	Reports ReportsController `controller:"true" timeout:"2m"`
+	//	ExportTimeout struct{} `timeout:"0"`
+	Handler time.Duration
+}
+
+var defaultTimeouts = Timeouts{
+	ReadHeader: 10 * time.Second,
+	Idle:       2 * time.Minute,
+}
+
+// merge returns t with its zero fields taken from def.
+func (t Timeouts) merge(def Timeouts) Timeouts {
+	pick := func(d, def time.Duration) time.Duration {
+		if d == 0 {
+			return def
+		}
+		return d
+	}
+
+	return Timeouts{
+		ReadHeader: pick(t.ReadHeader, def.ReadHeader),
+		Read:       pick(t.Read, def.Read),
+		Write:      pick(t.Write, def.Write),
+		Idle:       pick(t.Idle, def.Idle),
+		Handler:    pick(t.Handler, def.Handler),
+	}
+}
+
+// positive maps a disabled (negative) timeout to the zero value net/http uses.
+func positive(d time.Duration) time.Duration {
+	return max(d, 0)
+}
+
+// ServerOption configures a Server.
+type ServerOption func(s *Server)
+
+// WithDist sets the directory static files are served from.
+func WithDist(dist string) ServerOption {
+	return func(s *Server) { s.dist = dist }
+}
+
+// WithBind sets the address the server listens on, e.g. ":8443".
+func WithBind(bind string) ServerOption {
+	return func(s *Server) { s.bind = bind }
+}
+
+// WithTLS makes the server serve HTTPS with the given certificate and key.
+func WithTLS(cert, key string) ServerOption {
+	return func(s *Server) {
+		s.cert = cert
+		s.key = key
+		s.useTLS = true
+	}
+}
+
+// WithTLSConfig makes the server serve HTTPS with cfg, for example to require
+// TLS 1.3 or client certificates. If cfg provides its own certificates
+// (Certificates or GetCertificate) WithTLS is not needed.
+func WithTLSConfig(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+		s.useTLS = true
+	}
+}
+
+// WithHTTPRedirect starts a second, plain HTTP listener on addr, e.g. ":80",
+// answering every request with a 308 Permanent Redirect to its HTTPS
+// equivalent on the main listener.
+func WithHTTPRedirect(addr string) ServerOption {
+	return func(s *Server) { s.redirectAddr = addr }
+}
+
+// WithHealthCheck serves path, e.g. "/healthz", with a 200 OK JSON status for
+// liveness probes and load balancers. The endpoint bypasses middlewares,
+// sessions, authentication and controllers.
+func WithHealthCheck(path string) ServerOption {
+	return func(s *Server) { s.healthPath = path }
+}
+
+// WithGzip compresses responses of at least minSize bytes for clients
+// accepting gzip. Responses whose content type starts with one of skipTypes
+// are sent as they are; without skipTypes, the already compressed types of
+// DefaultGzipSkipTypes, such as images, archives and PDF files, are. To add
+// a type to the defaults:
+//
+//	WithGzip(1024, append(DefaultGzipSkipTypes(), "application/wasm")...)
+func WithGzip(minSize int, skipTypes ...string) ServerOption {
+	return func(s *Server) {
+		s.gzipMinSize = max(minSize, 0)
+		s.gzipSkip = DefaultGzipSkipTypes()
+		if len(skipTypes) > 0 {
+			s.gzipSkip = slices.Clone(skipTypes)
+		}
+	}
+}
+
+// WithRequestID gives every request a correlation ID: the X-Request-ID
+// header of the request, or a random UUID if it has none. The ID is echoed in
+// the X-Request-ID response header, logged and available to handlers through
+// PoliteRequest.RequestID.
+func WithRequestID() ServerOption {
+	return func(s *Server) { s.requestID = true }
+}
+
+// WithPanicHandler sets fn to answer requests whose handling panicked, e.g. to
+// report the panic to an error tracker. The panic is logged anyway. By default
+// the client gets a 500 Internal Server Error with a JSON error body.
+func WithPanicHandler(fn func(w http.ResponseWriter, r *http.Request, recovered interface{})) ServerOption {
+	return func(s *Server) { s.panicHandler = fn }
+}
+
+// WithNotFoundHandler sets fn to build the response to requests matching no
+// handler nor static file, e.g. the index.html of a single-page app. A
+// response whose status was not set with SetStatus is sent as 404; set it to
+// 200 OK to serve the page as a success. By default a JsonResponse with a
+// "not found" error is sent. Handlers set with SetNotFoundHandler or
+// SetErrorHandler, which apply to every Server, take precedence.
+func WithNotFoundHandler(fn func() Response) ServerOption {
+	return func(s *Server) { s.notFound = fn }
+}
+
+// WithErrorHandler sets fn to build the response to requests failing with a
+// 5xx status; err is the error returned by the handler, if any. A response
+// whose status was not set with SetStatus is sent with the error status. By
+// default a JsonResponse with a generic error is sent. Handlers set with
+// SetErrorHandler, which apply to every Server, take precedence.
+func WithErrorHandler(fn func(err error) Response) ServerOption {
+	return func(s *Server) { s.onError = fn }
+}
+
+// WithTimeouts sets the connection and request timeouts; see Timeouts.
+func WithTimeouts(t Timeouts) ServerOption {
+	return func(s *Server) { s.timeouts = t.merge(s.timeouts) }
+}
+
+// WithSessionDump sets the file sessions are dumped to and restored from.
+func WithSessionDump(path string) ServerOption {
+	return func(s *Server) { s.sessionDumpPath = path }
+}
+
+// WithShutdownTimeout sets how long a shutdown waits for in-flight requests
+// to complete. Defaults to 10 seconds.
+func WithShutdownTimeout(d time.Duration) ServerOption {
+	return func(s *Server) { s.shutdownTimeout = d }
+}
+
+// NewServer creates a Server for rootController. Without options it serves
+// plain HTTP on the default port, with no static files and no session dump.
+func NewServer(rootController interface{}, opts ...ServerOption) *Server {
+	s := &Server{
+		rootController:  rootController,
+		shutdownTimeout: defaultShutdownTimeout,
+		gzipMinSize:     -1,
+		timeouts:        defaultTimeouts,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Run starts the server and blocks until it is shut down by SIGINT or SIGTERM.
+// It returns nil after a graceful shutdown.
+func (s *Server) Run() error {
+	return <-s.RunWithContext(context.Background())
+}
+
+// RunWithContext starts the server and returns at once. The server stops when
+// ctx is done, as well as on SIGINT or SIGTERM: it stops accepting
+// connections, lets in-flight requests complete and dumps the sessions.
+// Then the outcome is sent on the returned channel, nil for a clean shutdown,
+// and the channel is closed.
+func (s *Server) RunWithContext(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+
+	if s.useTLS && (s.cert == "" || s.key == "") && !s.hasTLSCertificates() {
+		done <- utility.AppendError(fmt.Errorf("TLS requires a certificate and a key"))
+		close(done)
+		return done
+	}
+
+	if err := validateController(s.rootController); err != nil {
+		done <- utility.AppendError(err)
+		close(done)
+		return done
+	}
+
+	handler := getHandler(s.rootController, s.dist)
+
+	if err := RestoreSessions(s.sessionDumpPath); err != nil {
+		utility.Logf(utility.ERROR, "could not restore sessions: %s", err.Error())
+	}
+
+	setWriteThroughPath(s.sessionDumpPath)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", withDefaultServeMux(handler))
+
+	if s.healthPath != "" {
+		mux.HandleFunc(s.healthPath, healthCheck)
+	}
+
+	var root http.Handler = withResponders(mux, responders{
+		notFound: s.notFound,
+		onError:  s.onError,
+		panic:    s.panicHandler,
+	})
+	if s.timeouts.Handler > 0 {
+		root = withHandlerTimeout(root, s.timeouts.Handler)
+	}
+	if s.gzipMinSize >= 0 {
+		root = withGzip(root, s.gzipMinSize, s.gzipSkip)
+	}
+	if s.requestID {
+		root = withRequestID(root)
+	}
+
+	srv := &http.Server{
+		Addr:              s.bind,
+		Handler:           root,
+		TLSConfig:         s.tlsConfig,
+		ReadHeaderTimeout: positive(s.timeouts.ReadHeader),
+		ReadTimeout:       positive(s.timeouts.Read),
+		WriteTimeout:      positive(s.timeouts.Write),
+		IdleTimeout:       positive(s.timeouts.Idle),
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM) // -syscall.SIGHUP
+
+	if interval := getDumpInterval(); s.sessionDumpPath != "" && interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					chronoSerializeIfDirty(s.sessionDumpPath)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	servers := []*http.Server{srv}
+	served := make(chan error, 2)
+
+	go func() {
+		if s.useTLS {
+			served <- srv.ListenAndServeTLS(s.cert, s.key)
+		} else {
+			served <- srv.ListenAndServe()
+		}
+	}()
+
+	if s.redirectAddr != "" {
+		rsrv := &http.Server{
+			Addr:              s.redirectAddr,
+			Handler:           httpsRedirect(s.bind),
+			ReadHeaderTimeout: positive(s.timeouts.ReadHeader),
+			IdleTimeout:       positive(s.timeouts.Idle),
+		}
+		servers = append(servers, rsrv)
+
+		go func() {
+			served <- rsrv.ListenAndServe()
+		}()
+	}
+
+	go func() {
+		var err error
+		running := len(servers)
+
+		keep := func(serr error) {
+			if err == nil && !errors.Is(serr, http.ErrServerClosed) {
+				err = serr
+			}
+		}
+
+		defer close(done)
+		defer stop()
+
+		select {
+		case serr := <-served:
+			keep(serr)
+			running--
+		case <-ctx.Done():
+			utility.Logf(utility.INFO, "SafeExit: %v", context.Cause(ctx))
+		}
+
+		sctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		for _, srv := range servers {
+			keep(srv.Shutdown(sctx))
+		}
+		cancel()
+
+		for ; running > 0; running-- {
+			keep(<-served)
+		}
+
+		if s.sessionDumpPath != "" {
+			chronoSerialize(s.sessionDumpPath)
+		}
+
+		done <- err
+	}()
+
+	return done
+}
+
+// hasTLSCertificates reports whether the TLS config provides certificates, so
+// that no certificate and key files are needed.
+func (s *Server) hasTLSCertificates() bool {
+	return s.tlsConfig != nil && (len(s.tlsConfig.Certificates) > 0 || s.tlsConfig.GetCertificate != nil)
+}
+
+// ServerConfig gathers the settings of RunServer.
+type ServerConfig struct {
+	RootController  interface{}
+	Dist            string
+	Bind            string
+	Cert            string // with Key, serve HTTPS
+	Key             string
+	SessionDumpPath string
+	Timeouts        Timeouts
+}
+
+// RunServer starts a server configured by cfg and blocks until it is shut
+// down by SIGINT or SIGTERM. It returns nil after a graceful shutdown.
+func RunServer(cfg ServerConfig) error {
+	opts := []ServerOption{
+		WithDist(cfg.Dist),
+		WithBind(cfg.Bind),
+		WithSessionDump(cfg.SessionDumpPath),
+		WithTimeouts(cfg.Timeouts),
+	}
+	if cfg.Cert != "" || cfg.Key != "" {
+		opts = append(opts, WithTLS(cfg.Cert, cfg.Key))
+	}
+
+	return NewServer(cfg.RootController, opts...).Run()
+}
+
+// Run starts the server. If cert and key are both empty it serves plain
+// HTTP, as needed behind a TLS-terminating reverse proxy; otherwise HTTPS.
+// It returns after a graceful shutdown triggered by SIGINT or SIGTERM.
+// New code should prefer NewServer, which takes options.
+func Run(rootController interface{}, dist string, bind string, cert string, key string, sessionDumpPath string) {
+	utility.Mypanic(RunServer(ServerConfig{
+		RootController:  rootController,
+		Dist:            dist,
+		Bind:            bind,
+		Cert:            cert,
+		Key:             key,
+		SessionDumpPath: sessionDumpPath,
+	}))
+}
+
+// RunTLS is like Run but always serves HTTPS: cert and key are required.
+func RunTLS(rootController interface{}, dist string, bind string, cert string, key string, sessionDumpPath string) {
+	s := NewServer(rootController, WithDist(dist), WithBind(bind), WithTLS(cert, key), WithSessionDump(sessionDumpPath))
+	utility.Mypanic(s.Run())
+}
+
+// RunWithContext is like Run, but returns at once; see Server.RunWithContext.
+func RunWithContext(ctx context.Context, rootController interface{}, dist string, bind string, cert string, key string, sessionDumpPath string) <-chan error {
+	opts := []ServerOption{WithDist(dist), WithBind(bind), WithSessionDump(sessionDumpPath)}
+	if cert != "" || key != "" {
+		opts = append(opts, WithTLS(cert, key))
+	}
+
+	return NewServer(rootController, opts...).RunWithContext(ctx)
+}
+
+// httpsRedirect redirects to the same URL over HTTPS, on the port of bind
+// unless it is the default one.
+func httpsRedirect(bind string) http.Handler {
+	_, port, _ := net.SplitHostPort(bind)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := remoteHost(r.Host)
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+	})
+}
+
+func healthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"sessions": SessionCount(),
+	})
+}
+
+// withDefaultServeMux serves the requests matching a pattern registered on
+// http.DefaultServeMux by the application, and everything else with handler.
+func withDefaultServeMux(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, pattern := http.DefaultServeMux.Handler(r); pattern != "" {
+			h.ServeHTTP(w, r)
+		} else {
+			handler(w, r)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address nobody is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+// getWhenUp polls url until the server answers, failing the test after a
+// few seconds.
+func getWhenUp(t *testing.T, url string) *http.Response {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if resp, err := http.Get(url); err == nil {
+			return resp
+		}
+	}
+
+	t.Fatalf("server at %s never came up", url)
+	return nil
+}
+
+func TestRunWithContext(t *testing.T) {
+	withSessionStore(t)
+	addr := freeAddr(t)
+	dump := filepath.Join(t.TempDir(), "sessions.json")
+	t.Cleanup(func() { setWriteThroughPath("") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := RunWithContext(ctx, publicRoot{}, "", addr, "", "", dump)
+
+	resp := getWhenUp(t, "http://"+addr+"/Public/Home")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop on cancel")
+	}
+
+	if _, err := os.Stat(dump); err != nil {
+		t.Errorf("no final session dump: %v", err)
+	}
+	if _, err := http.Get("http://" + addr + "/Public/Home"); err == nil {
+		t.Error("server still answering after shutdown")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+type serverTimingKey struct{}
+
+type serverTimingEntry struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTiming collects the timings recorded while handling one request.
+type serverTiming struct {
+	lock    *sync.Mutex
+	start   time.Time // when the request was received
+	entries []serverTimingEntry
+}
+
+var serverTimingLock = &sync.RWMutex{}
+var serverTimingEnabled = false
+
+// EnableServerTiming sets whether timings recorded by handlers are reported
+// to clients through the Server-Timing response header. When enabled, every
+// response carries it, error ones included, with the time spent in the
+// handler as "handler" and the time until the headers were sent as "total".
+// Disabled by default, in which case recording timings costs nothing.
+func EnableServerTiming(enabled bool) {
+	defer utility.Monitor(serverTimingLock)()
+	serverTimingEnabled = enabled
+}
+
+func isServerTimingEnabled() bool {
+	defer utility.RMonitor(serverTimingLock)()
+	return serverTimingEnabled
+}
+
+// withServerTiming attaches a timing recorder to the context of r, and wraps
+// w so that the timings are sent with the headers, whatever writes them.
+func withServerTiming(r *http.Request, w http.ResponseWriter) (*http.Request, http.ResponseWriter) {
+	st := &serverTiming{lock: &sync.Mutex{}, start: time.Now()}
+	r = r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, st))
+	return r, &timingWriter{ResponseWriter: w, timing: st}
+}
+
+// timingWriter sets the Server-Timing header right before the headers are
+// written, adding the time elapsed so far as "total".
+type timingWriter struct {
+	http.ResponseWriter
+	timing *serverTiming
+	sent   bool
+}
+
+func (tw *timingWriter) setHeader() {
+	if !tw.sent {
+		tw.sent = true
+		tw.timing.record("total", time.Since(tw.timing.start))
+		tw.Header().Set("Server-Timing", tw.timing.header())
+	}
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	tw.setHeader()
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	tw.setHeader()
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timingWriter) Flush() {
+	tw.setHeader()
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// RecordTiming records that the step name (an HTTP token, such as "db") of
+// the request carrying ctx took d. It does nothing if Server-Timing is
+// disabled.
+func RecordTiming(ctx context.Context, name string, d time.Duration) {
+	if st, ok := ctx.Value(serverTimingKey{}).(*serverTiming); ok {
+		st.record(name, d)
+	}
+}
+
+func (st *serverTiming) record(name string, d time.Duration) {
+	defer utility.Monitor(st.lock)()
+	st.entries = append(st.entries, serverTimingEntry{name: name, dur: d})
+}
+
+// StartTiming starts timing the step name and returns the function that
+// stops it and records the timing:
+//
+//	defer StartTiming(pr.Context(), "db")()
+func StartTiming(ctx context.Context, name string) func() {
+	start := time.Now()
+	return func() {
+		RecordTiming(ctx, name, time.Since(start))
+	}
+}
+
+// header returns the value of the Server-Timing header, e.g. "db;dur=12.5".
+func (st *serverTiming) header() string {
+	defer utility.Monitor(st.lock)()
+
+	parts := make([]string, len(st.entries))
+	for i, e := range st.entries {
+		ms := float64(e.dur.Microseconds()) / 1000
+		parts[i] = e.name + ";dur=" + strconv.FormatFloat(ms, 'f', -1, 64)
+	}
+
+	return strings.Join(parts, ", ")
+}
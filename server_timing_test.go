@@ -0,0 +1,64 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timedController struct{}
+
+func (timedController) QueryGet(s *Session, pr PoliteRequest) string {
+	RecordTiming(pr.Context(), "db", 12*time.Millisecond)
+	return "rows"
+}
+
+func (timedController) BrokenGet(s *Session, pr PoliteRequest) error {
+	RecordTiming(pr.Context(), "db", time.Millisecond)
+	return http.ErrNoLocation
+}
+
+type timedRoot struct {
+	Api timedController `controller:"true" public:"true"`
+}
+
+func TestServerTiming(t *testing.T) {
+	EnableServerTiming(true)
+	t.Cleanup(func() { EnableServerTiming(false) })
+
+	tests := []struct {
+		path   string
+		status int
+		want   []string
+	}{
+		{"/Api/Query", http.StatusOK, []string{"db;dur=12", "handler;dur=", "total;dur="}},
+		{"/Api/Broken", http.StatusInternalServerError, []string{"db;dur=1", "handler;dur=", "total;dur="}},
+		{"/Api/Missing", http.StatusNotFound, []string{"total;dur="}},
+	}
+
+	for _, tt := range tests {
+		w := serve(timedRoot{}, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		h := w.Header().Get("Server-Timing")
+
+		if w.Code != tt.status {
+			t.Errorf("GET %s: got %d, want %d", tt.path, w.Code, tt.status)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(h, want) {
+				t.Errorf("GET %s: Server-Timing %q lacks %q", tt.path, h, want)
+			}
+		}
+	}
+}
+
+func TestServerTimingDisabled(t *testing.T) {
+	w := serve(timedRoot{}, httptest.NewRequest(http.MethodGet, "/Api/Query", nil))
+	if h := w.Header().Get("Server-Timing"); h != "" {
+		t.Errorf("Server-Timing %q sent while disabled", h)
+	}
+}
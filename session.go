@@ -4,17 +4,129 @@
 package goapi
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/mattia-cabrini/go-utility"
 )
 
+// Session data key under which flash messages are kept. Flash messages live
+// in the ordinary data map so that they are dumped and restored with it.
+const flashNamespace = "__flash__"
+
+// CookieConfig describes the attributes of the session cookie.
+type CookieConfig struct {
+	Name     string
+	Domain   string
+	Path     string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+var cookieConfigLock = &sync.RWMutex{}
+var cookieConfig = CookieConfig{
+	Name:     "sessionid",
+	Path:     "/",
+	Secure:   true,
+	HttpOnly: true,
+	SameSite: http.SameSiteStrictMode,
+}
+
+// SetCookieConfig replaces the session cookie attributes.
+// An empty Name keeps the default "sessionid".
+func SetCookieConfig(cfg CookieConfig) {
+	defer utility.Monitor(cookieConfigLock)()
+
+	if cfg.Name == "" {
+		cfg.Name = "sessionid"
+	}
+
+	cookieConfig = cfg
+}
+
+func getCookieConfig() CookieConfig {
+	defer utility.RMonitor(cookieConfigLock)()
+	return cookieConfig
+}
+
+var sessionTTLLock = &sync.RWMutex{}
+var sessionTTL = 15 * time.Minute
+
+// SetSessionTTL sets how long a session lives after its last operation.
+// Sessions idle for longer are not restored from a dump.
+func SetSessionTTL(ttl time.Duration) {
+	defer utility.Monitor(sessionTTLLock)()
+	sessionTTL = ttl
+}
+
+func getSessionTTL() time.Duration {
+	defer utility.RMonitor(sessionTTLLock)()
+	return sessionTTL
+}
+
+// ErrSessionDataLimit is returned by Session.Set when the write would make the
+// session data exceed the limit set with SetSessionDataLimit.
+var ErrSessionDataLimit = errors.New("session data size limit exceeded")
+
+var sessionDataLimitLock = &sync.RWMutex{}
+var sessionDataLimit = 0
+
+// SetSessionDataLimit caps the size of each session's data, measured as its
+// JSON encoding, in bytes. 0 (the default) means unlimited.
+func SetSessionDataLimit(bytes int) {
+	defer utility.Monitor(sessionDataLimitLock)()
+	sessionDataLimit = bytes
+}
+
+func getSessionDataLimit() int {
+	defer utility.RMonitor(sessionDataLimitLock)()
+	return sessionDataLimit
+}
+
+// activeSessionsLock serializes the operations spanning several calls to the
+// session store, such as allocating a new unique ID.
 var activeSessionsLock = &sync.RWMutex{}
-var activeSessions = make(map[string]*Session)
+
+// sessionsDirty tells whether any session changed since the last dump.
+var sessionsDirty = false
+
+func markSessionsDirty() {
+	defer utility.Monitor(activeSessionsLock)()
+	sessionsDirty = true
+}
+
+func sessionsChanged() bool {
+	defer utility.RMonitor(activeSessionsLock)()
+	return sessionsDirty
+}
+
+// RangeSessions calls fn for each active session until fn returns false,
+// e.g. to list who is online or to Delete the sessions of a user.
+func RangeSessions(fn func(s *Session) bool) {
+	getSessionStore().Range(fn)
+}
+
+// SessionCount returns the number of active sessions.
+func SessionCount() int {
+	n := 0
+	getSessionStore().Range(func(*Session) bool {
+		n++
+		return true
+	})
+	return n
+}
 
 type Session struct {
 	id       string
@@ -29,10 +141,11 @@ func newSession(id string) (s *Session, err error) {
 	defer utility.Monitor(activeSessionsLock)()
 
 	var b = false
+	var store = getSessionStore()
 
 	if id == "" {
 		for id, err = utility.RandString(24); err == nil; id, err = utility.RandString(24) {
-			_, b := activeSessions[id]
+			_, b := store.Get(id)
 			if !b { // not duplicated session id
 				break
 			}
@@ -44,90 +157,398 @@ func newSession(id string) (s *Session, err error) {
 		return
 	}
 
-	if s, b = activeSessions[id]; !b {
+	if s, b = store.Get(id); !b {
 		s = &Session{
 			id:        id,
 			innerLock: &sync.RWMutex{},
 			data:      make(map[string]interface{}),
 		}
-		activeSessions[id] = s
+		sessionsDirty = true
 	}
 
+	s.innerLock.Lock()
 	s.lastOp = time.Now()
+	s.innerLock.Unlock()
+
+	store.Put(s)
 
 	return
 }
 
+// ID returns the session ID, the value of the session cookie.
+func (s *Session) ID() string {
+	defer utility.RMonitor(s.innerLock)()
+	return s.id
+}
+
+// LastOp returns when the session was last used by a request.
+func (s *Session) LastOp() time.Time {
+	defer utility.RMonitor(s.innerLock)()
+	return s.lastOp
+}
+
+// ExpiresAt returns when the session expires if left idle: its last
+// operation plus the session TTL.
+func (s *Session) ExpiresAt() time.Time {
+	defer utility.RMonitor(s.innerLock)()
+	return s.lastOp.Add(getSessionTTL())
+}
+
 func (s *Session) User() string {
 	defer utility.RMonitor(s.innerLock)()
 	return s.userName
 }
 
 func (s *Session) SetUser(usr string) {
-	defer utility.RMonitor(s.innerLock)()
+	defer writeThrough()
+	defer utility.Monitor(s.innerLock)()
 	s.userName = usr
 }
 
 func (s *Session) Get(key string) (v interface{}) {
-	defer utility.RMonitor(s.innerLock)()
+	v, _ = s.lookup(key)
+	return v
+}
+
+// lookup returns the value stored under key and whether there is one. It
+// takes innerLock for writing, since it updates lastOp.
+func (s *Session) lookup(key string) (interface{}, bool) {
+	defer utility.Monitor(s.innerLock)()
 	s.lastOp = time.Now()
-	v, b := s.data[key]
+	v, ok := s.data[key]
+	return v, ok
+}
 
-	if !b {
-		v = nil
+// GetOr returns the value stored under key, or def if there is none.
+func (s *Session) GetOr(key string, def interface{}) interface{} {
+	if v, ok := s.lookup(key); ok {
+		return v
 	}
+	return def
+}
 
-	return v
+// GetString returns the value stored under key if it is a string.
+func (s *Session) GetString(key string) (string, bool) {
+	v, _ := s.lookup(key)
+	str, ok := v.(string)
+	return str, ok
+}
+
+// GetInt returns the value stored under key if it is an integer. A whole
+// float64 counts, since that is what an int turns into once the session is
+// dumped and restored.
+func (s *Session) GetInt(key string) (int, bool) {
+	v, _ := s.lookup(key)
+
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt && n < math.MaxInt {
+			return int(n), true
+		}
+	}
+
+	return 0, false
 }
 
-func (s *Session) Set(key string, v interface{}) {
+// GetBool returns the value stored under key if it is a bool.
+func (s *Session) GetBool(key string) (bool, bool) {
+	v, _ := s.lookup(key)
+	b, ok := v.(bool)
+	return b, ok
+}
+
+func (s *Session) Set(key string, v interface{}) error {
+	defer writeThrough()
 	defer utility.Monitor(s.innerLock)()
 	s.lastOp = time.Now()
+
+	return s.store(key, v)
+}
+
+// store sets key to v. With a data size limit, the write is undone if the
+// data would exceed it or could not be encoded to be measured.
+// Must be called holding innerLock for writing.
+func (s *Session) store(key string, v interface{}) error {
+	limit := getSessionDataLimit()
+	if limit <= 0 {
+		s.data[key] = v
+		return nil
+	}
+
+	old, had := s.data[key]
 	s.data[key] = v
+
+	size, err := s.dataSize()
+	if err == nil && size <= limit {
+		return nil
+	}
+
+	if had {
+		s.data[key] = old
+	} else {
+		delete(s.data, key)
+	}
+
+	if err != nil {
+		utility.Logf(utility.WARNING, "session %s: dropped write of %q, data cannot be encoded: %v", s.id, key, err)
+		return utility.AppendError(err)
+	}
+
+	utility.Logf(utility.WARNING, "session %s: dropped write of %q, data would be %d bytes (limit %d)", s.id, key, size, limit)
+	return ErrSessionDataLimit
+}
+
+// GetOrSet returns the value stored under key. If there is none, it stores
+// and returns the result of factory, all while holding the write lock. A
+// result rejected by the data size limit is returned but not stored.
+func (s *Session) GetOrSet(key string, factory func() interface{}) interface{} {
+	defer writeThrough()
+	defer utility.Monitor(s.innerLock)()
+	s.lastOp = time.Now()
+
+	if v, b := s.data[key]; b {
+		return v
+	}
+
+	v := factory()
+	_ = s.store(key, v)
+
+	return v
+}
+
+// DataSize returns the approximate size of the session data: the length of
+// its JSON encoding, or -1 if the data cannot be encoded.
+func (s *Session) DataSize() int {
+	defer utility.RMonitor(s.innerLock)()
+
+	size, err := s.dataSize()
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+func (s *Session) dataSize() (int, error) {
+	b, err := json.Marshal(s.data)
+	return len(b), err
+}
+
+// Flash stores a message meant to be read exactly once, by PopFlash. A
+// message rejected by the data size limit is dropped.
+func (s *Session) Flash(key, value string) {
+	defer writeThrough()
+	defer utility.Monitor(s.innerLock)()
+	s.lastOp = time.Now()
+
+	// Store a copy, so that a rejected write leaves the messages untouched
+	flash, _ := s.data[flashNamespace].(map[string]interface{})
+	flash = maps.Clone(flash)
+	if flash == nil {
+		flash = make(map[string]interface{})
+	}
+
+	flash[key] = value
+	_ = s.store(flashNamespace, flash)
+}
+
+// PopFlash returns the flash message stored under key and removes it.
+func (s *Session) PopFlash(key string) (value string, ok bool) {
+	defer writeThrough()
+	defer utility.Monitor(s.innerLock)()
+	s.lastOp = time.Now()
+
+	flash, _ := s.data[flashNamespace].(map[string]interface{})
+	if value, ok = flash[key].(string); ok {
+		delete(flash, key)
+	}
+
+	return
+}
+
+// Reset discards the user and all the data of the session while keeping its
+// id, so the client's cookie stays valid.
+func (s *Session) Reset() {
+	defer writeThrough()
+	defer utility.Monitor(s.innerLock)()
+	s.lastOp = time.Now()
+	s.userName = ""
+	s.data = make(map[string]interface{})
 }
 
 func (s *Session) Delete() {
+	defer writeThrough()
+	defer utility.Monitor(activeSessionsLock)()
+	getSessionStore().Delete(s.id)
+}
+
+// Regenerate moves the session under a fresh random ID, so that an ID known
+// before login is useless afterwards (session fixation). Login handlers
+// should call it right after SetUser and set the returned cookie on their
+// response with AddCookie.
+func (s *Session) Regenerate() (*http.Cookie, error) {
+	defer writeThrough()
+
+	if err := s.regenerate(); err != nil {
+		return nil, err
+	}
+
+	return s.GetCookie(), nil
+}
+
+func (s *Session) regenerate() error {
+	defer utility.Monitor(activeSessionsLock)()
+
+	store := getSessionStore()
+
+	id, err := utility.RandString(24)
+	for ; err == nil; id, err = utility.RandString(24) {
+		if _, b := store.Get(id); !b { // not duplicated session id
+			break
+		}
+	}
+
+	if err != nil {
+		return utility.AppendError(err)
+	}
+
 	defer utility.Monitor(s.innerLock)()
-	delete(activeSessions, s.id)
+
+	store.Delete(s.id)
+	s.id = id
+	store.Put(s)
+
+	return nil
 }
 
 func (s *Session) GetCookie() *http.Cookie {
+	cfg := getCookieConfig()
+
 	return &http.Cookie{
-		Name:     "sessionid",
-		Value:    s.id,
-		Secure:   true,
-		Expires:  time.Now().Add(15 * time.Minute),
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-		Path:     "/",
+		Name:     cfg.Name,
+		Value:    s.ID(),
+		Domain:   cfg.Domain,
+		Path:     cfg.Path,
+		MaxAge:   cfg.MaxAge,
+		Secure:   cfg.Secure,
+		Expires:  s.ExpiresAt(),
+		HttpOnly: cfg.HttpOnly,
+		SameSite: cfg.SameSite,
 	}
 }
 
+// Version of the session dump format written by SessionDump. Version 1 had
+// bare session records; version 2 wraps each in a checkedRecord.
+const sessionDumpVersion = 2
+
+// sessionDump is the content of a session dump file.
+type sessionDump struct {
+	Version  int                      `json:"version"`
+	Sessions map[string]checkedRecord `json:"sessions"`
+}
+
+// checkedRecord is a serialized sessionRecord with its SHA-256 checksum, so
+// that a corrupted record can be skipped alone.
+type checkedRecord struct {
+	Checksum string          `json:"checksum"`
+	Session  json.RawMessage `json:"session"`
+}
+
+func recordChecksum(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionRecord is a session as stored in a dump.
+type sessionRecord struct {
+	ID       string                 `json:"id"`
+	Data     map[string]interface{} `json:"data"`
+	LastOp   string                 `json:"lastOp"`
+	UserName string                 `json:"userName"`
+}
+
+// marshalRecord encodes the session as a dump record, holding its lock so
+// that concurrent writes are not seen halfway.
+func (s *Session) marshalRecord() ([]byte, error) {
+	defer utility.RMonitor(s.innerLock)()
+
+	return json.Marshal(sessionRecord{
+		ID:       s.id,
+		Data:     s.data,
+		LastOp:   s.lastOp.Format(time.RFC3339Nano),
+		UserName: s.userName,
+	})
+}
+
 func SessionDump(path string) error {
 	defer utility.Monitor(activeSessionsLock)()
 
-	var m = make(map[string]interface{})
+	var dump = sessionDump{
+		Version:  sessionDumpVersion,
+		Sessions: make(map[string]checkedRecord),
+	}
+
+	getSessionStore().Range(func(sx *Session) bool {
+		raw, err := sx.marshalRecord()
+
+		if err != nil {
+			utility.Logf(utility.ERROR, "session %s not dumped: %v", sx.id, err)
+		} else {
+			dump.Sessions[sx.id] = checkedRecord{Checksum: recordChecksum(raw), Session: raw}
+		}
 
-	for _, sx := range activeSessions {
-		var mx = make(map[string]interface{})
+		return true
+	})
 
-		mx["id"] = sx.id
-		mx["data"] = sx.data
-		mx["lastOp"] = sx.lastOp
-		mx["userName"] = sx.userName
+	sessionsDirty = false
 
-		m[sx.id] = mx
+	// Write to a temporary file in the same directory and rename it over
+	// path: a crash while writing leaves the previous dump untouched.
+	content, err := json.Marshal(dump)
+	if err == nil {
+		content, err = sealDump(content)
+	}
+	if err != nil {
+		sessionsDirty = true
+		return utility.AppendError(err)
 	}
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err == nil {
-		enc := json.NewEncoder(f)
-		err = enc.Encode(m)
+		_, err = f.Write(content)
+
+		if err == nil {
+			err = f.Sync()
+		}
+
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err == nil {
+			err = os.Rename(f.Name(), path)
+		}
+
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}
+
+	if err != nil {
+		sessionsDirty = true
 	}
 
 	return utility.AppendError(err)
 }
 
+// RestoreSessions loads the sessions dumped at sessionDumpPath, skipping the
+// expired ones. Malformed records are logged and skipped; an unreadable or
+// undecodable file, or one of an unknown version, is an error.
 func RestoreSessions(sessionDumpPath string) error {
 	defer utility.Monitor(activeSessionsLock)()
 
@@ -135,28 +556,104 @@ func RestoreSessions(sessionDumpPath string) error {
 		return nil
 	}
 
-	var m = make(map[string]interface{})
+	content, err := os.ReadFile(sessionDumpPath)
+	if err != nil {
+		return utility.AppendError(err)
+	}
 
-	f, err := os.OpenFile(sessionDumpPath, os.O_RDONLY, 0600)
-	if err == nil {
-		dec := json.NewDecoder(f)
-		dec.Decode(&m)
-
-		for _, mxi := range m {
-			var mx = mxi.(map[string]interface{})
-
-			tm, _ := time.Parse(time.RFC3339Nano, mx["lastOp"].(string))
-			var sx = &Session{
-				id:        mx["id"].(string),
-				data:      mx["data"].(map[string]interface{}),
-				lastOp:    tm,
-				userName:  mx["userName"].(string),
-				innerLock: &sync.RWMutex{},
+	if content, err = openDump(content); err != nil {
+		utility.Logf(utility.ERROR, "could not decrypt %s, starting with no sessions: %v", sessionDumpPath, err)
+		return nil
+	}
+
+	var top map[string]json.RawMessage
+	if err = json.Unmarshal(content, &top); err != nil {
+		return utility.AppendError(fmt.Errorf("decoding %s: %v", sessionDumpPath, err))
+	}
+
+	records := top
+	checked := false
+
+	// Dumps without a version are the bare map of sessions keyed by ID
+	if rawVersion, ok := top["version"]; ok {
+		var dump struct {
+			Version  int                        `json:"version"`
+			Sessions map[string]json.RawMessage `json:"sessions"`
+		}
+
+		if err = json.Unmarshal(rawVersion, &dump.Version); err != nil || dump.Version < 1 || dump.Version > sessionDumpVersion {
+			return utility.AppendError(fmt.Errorf("%s: unsupported dump version %s", sessionDumpPath, rawVersion))
+		}
+
+		if err = json.Unmarshal(top["sessions"], &dump.Sessions); err != nil {
+			return utility.AppendError(fmt.Errorf("decoding %s: %v", sessionDumpPath, err))
+		}
+
+		records = dump.Sessions
+		checked = dump.Version >= 2
+	}
+
+	ttl := getSessionTTL()
+	skipped, malformed := 0, 0
+	store := getSessionStore()
+
+	for key, raw := range records {
+		var rec sessionRecord
+
+		if checked {
+			var cr checkedRecord
+
+			if err := json.Unmarshal(raw, &cr); err != nil {
+				utility.Logf(utility.WARNING, "skipping malformed session record %q: %v", key, err)
+				malformed++
+				continue
+			}
+
+			if recordChecksum(cr.Session) != cr.Checksum {
+				utility.Logf(utility.WARNING, "skipping session record %q: checksum mismatch", key)
+				malformed++
+				continue
 			}
 
-			activeSessions[sx.id] = sx
+			raw = cr.Session
+		}
+
+		if err := json.Unmarshal(raw, &rec); err != nil || rec.ID == "" {
+			utility.Logf(utility.WARNING, "skipping malformed session record %q: %v", key, err)
+			malformed++
+			continue
+		}
+
+		tm, err := time.Parse(time.RFC3339Nano, rec.LastOp)
+		if err != nil {
+			tm = time.Now()
+		}
+
+		if time.Since(tm) > ttl {
+			skipped++
+			continue
 		}
+
+		if rec.Data == nil {
+			rec.Data = make(map[string]interface{})
+		}
+
+		store.Put(&Session{
+			id:        rec.ID,
+			data:      rec.Data,
+			lastOp:    tm,
+			userName:  rec.UserName,
+			innerLock: &sync.RWMutex{},
+		})
 	}
 
-	return utility.AppendError(err)
+	if skipped > 0 {
+		utility.Logf(utility.INFO, "%d expired sessions not restored", skipped)
+	}
+
+	if malformed > 0 {
+		utility.Logf(utility.WARNING, "%d malformed sessions not restored", malformed)
+	}
+
+	return nil
 }
@@ -0,0 +1,87 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// SessionStore holds the active sessions. Implementations must be safe for
+// concurrent use. Put is called whenever a session is created or used by a
+// request.
+type SessionStore interface {
+	Get(id string) (*Session, bool)
+	Put(s *Session)
+	Delete(id string)
+	// Range calls fn for each session until fn returns false.
+	Range(fn func(s *Session) bool)
+}
+
+// MemoryStore is the default SessionStore, an in-memory map.
+type MemoryStore struct {
+	lock     *sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		lock:     &sync.RWMutex{},
+		sessions: make(map[string]*Session),
+	}
+}
+
+func (m *MemoryStore) Get(id string) (*Session, bool) {
+	defer utility.RMonitor(m.lock)()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+func (m *MemoryStore) Put(s *Session) {
+	defer utility.Monitor(m.lock)()
+	m.sessions[s.id] = s
+}
+
+func (m *MemoryStore) Delete(id string) {
+	defer utility.Monitor(m.lock)()
+	delete(m.sessions, id)
+}
+
+// Range iterates over a snapshot, so fn may use the store.
+func (m *MemoryStore) Range(fn func(s *Session) bool) {
+	m.lock.RLock()
+	snapshot := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		snapshot = append(snapshot, s)
+	}
+	m.lock.RUnlock()
+
+	for _, s := range snapshot {
+		if !fn(s) {
+			return
+		}
+	}
+}
+
+var sessionStoreLock = &sync.RWMutex{}
+var sessionStore SessionStore = NewMemoryStore()
+
+// SetSessionStore replaces the store holding the active sessions; nil restores
+// the default MemoryStore. Call it before starting the server: sessions in
+// the previous store are not moved.
+func SetSessionStore(s SessionStore) {
+	if s == nil {
+		s = NewMemoryStore()
+	}
+
+	defer utility.Monitor(sessionStoreLock)()
+	sessionStore = s
+}
+
+func getSessionStore() SessionStore {
+	defer utility.RMonitor(sessionStoreLock)()
+	return sessionStore
+}
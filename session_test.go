@@ -0,0 +1,262 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// withSessionStore gives the test an empty MemoryStore of its own.
+func withSessionStore(t *testing.T) {
+	t.Helper()
+	SetSessionStore(NewMemoryStore())
+	t.Cleanup(func() { SetSessionStore(nil) })
+}
+
+// mustSession creates a session, failing the test on error.
+func mustSession(t *testing.T) *Session {
+	t.Helper()
+	s, err := newSession("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSessionDumpPartialWriteKeepsPreviousDump(t *testing.T) {
+	withSessionStore(t)
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	s := mustSession(t)
+	s.Set("k", "v1")
+
+	if err := SessionDump(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash halfway through the next dump leaves a truncated temporary
+	// file behind; the dump at path must not be affected
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(filepath.Dir(path), filepath.Base(path)+".123.tmp")
+	if err := os.WriteFile(partial, previous[:len(previous)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	SetSessionStore(NewMemoryStore())
+	if err := RestoreSessions(path); err != nil {
+		t.Fatalf("restoring the previous dump: %v", err)
+	}
+
+	restored, ok := getSessionStore().Get(s.ID())
+	if !ok || restored.Get("k") != "v1" {
+		t.Fatal("session of the previous dump not restored")
+	}
+}
+
+func TestSessionDumpLeavesNoTemporaryFiles(t *testing.T) {
+	withSessionStore(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sessions.json")
+
+	mustSession(t).Set("k", "v")
+
+	for i := 0; i < 3; i++ {
+		if err := SessionDump(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files in the dump directory, want 1", len(entries))
+	}
+}
+
+func TestSessionDataLimit(t *testing.T) {
+	withSessionStore(t)
+	SetSessionDataLimit(64)
+	t.Cleanup(func() { SetSessionDataLimit(0) })
+
+	s := mustSession(t)
+
+	if err := s.Set("small", "ok"); err != nil {
+		t.Fatalf("small write rejected: %v", err)
+	}
+
+	big := strings.Repeat("x", 100)
+
+	if err := s.Set("small", big); !errors.Is(err, ErrSessionDataLimit) {
+		t.Errorf("oversized write: got %v, want ErrSessionDataLimit", err)
+	}
+	if s.Get("small") != "ok" {
+		t.Error("rejected write replaced the previous value")
+	}
+
+	if err := s.Set("ch", make(chan int)); err == nil {
+		t.Error("write of a value that cannot be encoded accepted")
+	}
+	if s.DataSize() < 0 {
+		t.Error("rejected value left in the session data")
+	}
+
+	if v := s.GetOrSet("lazy", func() interface{} { return big }); v != big {
+		t.Error("GetOrSet did not return the factory result")
+	}
+	if s.Get("lazy") != nil {
+		t.Error("GetOrSet stored a value over the limit")
+	}
+
+	s.Flash("msg", big)
+	if _, ok := s.PopFlash("msg"); ok {
+		t.Error("Flash stored a message over the limit")
+	}
+}
+
+// withWriteThrough enables write-through to path for the duration of the test.
+func withWriteThrough(t *testing.T, path string) {
+	t.Helper()
+	SetWriteThrough(true)
+	setWriteThroughPath(path)
+	t.Cleanup(func() {
+		SetWriteThrough(false)
+		setWriteThroughPath("")
+	})
+}
+
+func TestWriteThroughSurvivesCrash(t *testing.T) {
+	withSessionStore(t)
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	withWriteThrough(t, path)
+
+	s := mustSession(t)
+	s.SetUser("alice")
+	if err := s.Set("cart", "3 items"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crash: the process goes away without a final dump, and the next one
+	// starts from an empty store
+	SetSessionStore(NewMemoryStore())
+	if err := RestoreSessions(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, ok := getSessionStore().Get(s.ID())
+	if !ok {
+		t.Fatal("session lost")
+	}
+	if restored.User() != "alice" || restored.Get("cart") != "3 items" {
+		t.Errorf("restored user %q, cart %v", restored.User(), restored.Get("cart"))
+	}
+}
+
+func TestWriteThroughConcurrentWrites(t *testing.T) {
+	withSessionStore(t)
+	withWriteThrough(t, filepath.Join(t.TempDir(), "sessions.json"))
+
+	s := mustSession(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s.Set(fmt.Sprintf("k%d", i), j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, _ := s.GetInt("k0"); n != 19 {
+		t.Errorf("k0 = %d, want 19", n)
+	}
+}
+
+func TestRestoreSkipsCorruptedRecordAlone(t *testing.T) {
+	withSessionStore(t)
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	good, bad := mustSession(t), mustSession(t)
+	good.Set("k", "good")
+	bad.Set("k", "bad")
+
+	if err := SessionDump(path); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump sessionDump
+	if err := json.Unmarshal(content, &dump); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip the stored value of one record, leaving its checksum alone
+	rec := dump.Sessions[bad.ID()]
+	rec.Session = json.RawMessage(strings.Replace(string(rec.Session), `"bad"`, `"evil"`, 1))
+	dump.Sessions[bad.ID()] = rec
+
+	if content, err = json.Marshal(dump); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	SetSessionStore(NewMemoryStore())
+	if err := RestoreSessions(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := getSessionStore().Get(bad.ID()); ok {
+		t.Error("corrupted session restored")
+	}
+	if restored, ok := getSessionStore().Get(good.ID()); !ok || restored.Get("k") != "good" {
+		t.Error("intact session not restored")
+	}
+}
+
+func TestConcurrentReadsUpdateLastOp(t *testing.T) {
+	withSessionStore(t)
+
+	s := mustSession(t)
+	s.Set("k", "v")
+	before := s.LastOp()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Get("k")
+				s.GetString("k")
+				s.GetOr("missing", nil)
+				s.LastOp()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !s.LastOp().After(before) {
+		t.Error("reads did not update the last operation time")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+var staticLock = &sync.RWMutex{}
+var strictStatic = false
+var spaFallback = false
+var staticFirstPrefixes []string
+
+// SetStrictStatic sets whether static files are resolved strictly: only the
+// exact requested file, or the index.html of the exact requested directory,
+// is served. By default a missing path falls back to the closest existing
+// parent, and to its index.html.
+func SetStrictStatic(strict bool) {
+	defer utility.Monitor(staticLock)()
+	strictStatic = strict
+}
+
+func isStrictStatic() bool {
+	defer utility.RMonitor(staticLock)()
+	return strictStatic
+}
+
+// SetSPAFallback sets whether unknown paths are answered with the index.html
+// of the dist root, so that the router of a single-page app can handle them.
+// The fallback applies only to requests accepting HTML for paths that do not
+// look like assets: a missing .js or .css file is still a 404. Requests
+// matching a handler are not affected. Disabled by default.
+//
+// Note that the default, non-strict resolution already falls back to the
+// closest index.html; the SPA fallback matters mostly with SetStrictStatic.
+func SetSPAFallback(enabled bool) {
+	defer utility.Monitor(staticLock)()
+	spaFallback = enabled
+}
+
+func isSPAFallback() bool {
+	defer utility.RMonitor(staticLock)()
+	return spaFallback
+}
+
+// SetStaticFirst makes an existing static file win over a same-named handler
+// for the paths under each of prefixes, e.g. "/docs". Only exact files (or
+// directory index.html files) take precedence; anything else is routed to the
+// handlers as usual. By default handlers always come first. Each call
+// replaces the previous prefixes.
+func SetStaticFirst(prefixes ...string) {
+	defer utility.Monitor(staticLock)()
+	staticFirstPrefixes = append([]string(nil), prefixes...)
+}
+
+func isStaticFirst(urlPath string) bool {
+	defer utility.RMonitor(staticLock)()
+
+	for _, prefix := range staticFirstPrefixes {
+		prefix = "/" + strings.Trim(prefix, "/")
+		if prefix == "/" || urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveStaticFirst serves the file uri points to if it lies under a
+// static-first prefix and exists.
+func serveStaticFirst(dist string, uri URI, w http.ResponseWriter, r *http.Request) bool {
+	if dist == "" || !isStaticFirst(uri.path) || !uriWithinRoot(dist, uri) {
+		return false
+	}
+
+	uri.ResetStack()
+	return handleExactFile(dist, &uri, w, r) == nil
+}
+
+// serveSPAFallback serves the dist root's index.html in place of a missing
+// file, if the SPA fallback applies to r.
+func serveSPAFallback(dist string, uri *URI, w http.ResponseWriter, r *http.Request) bool {
+	if !isSPAFallback() || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+
+	if ext := path.Ext(uri.path); ext != "" && ext != ".html" {
+		return false
+	}
+
+	index := dist + "/index.html"
+	s, err := os.Stat(index)
+	if err != nil || s.IsDir() {
+		return false
+	}
+
+	serveStaticFile(w, r, index, s)
+	return true
+}
+
+// withinRoot reports whether filePath, once cleaned, is root or lies under it.
+func withinRoot(root, filePath string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(filePath))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// uriWithinRoot reports whether every path handleFile may try for uri stays
+// inside root. Since handleFile falls back through parents, each prefix of
+// the URI is checked, both as received and percent-decoded.
+func uriWithinRoot(root string, uri URI) bool {
+	raw, decoded := root, root
+
+	uri.ResetStack()
+
+	for uri.StackCount() > 0 {
+		part := uri.Pop()
+		raw += "/" + part
+
+		if dpart, err := url.PathUnescape(part); err == nil {
+			decoded += "/" + dpart
+		} else {
+			decoded += "/" + part
+		}
+
+		if !withinRoot(root, raw) || !withinRoot(root, decoded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleExactFile serves the file the whole of uri points to under dist, with
+// no fallback.
+func handleExactFile(dist string, uri *URI, w http.ResponseWriter, r *http.Request) error {
+	filePath := dist
+
+	for part := uri.Pop(); part != ""; part = uri.Pop() {
+		filePath += "/" + part
+	}
+
+	s, err := os.Stat(filePath)
+
+	if err == nil && s.IsDir() {
+		filePath += "/index.html"
+		s, err = os.Stat(filePath)
+	}
+
+	if err == nil && s.IsDir() {
+		err = os.ErrNotExist
+	}
+
+	if err == nil {
+		serveStaticFile(w, r, filePath, s)
+	}
+
+	return err
+}
+
+// serveStaticFile serves a file of dist with a weak ETag derived from its
+// modification time and size; a matching If-None-Match gets 304 Not Modified.
+// Assets other than HTML pages may be cached for an hour.
+func serveStaticFile(w http.ResponseWriter, r *http.Request, filePath string, s os.FileInfo) {
+	w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, s.ModTime().UnixNano(), s.Size()))
+
+	if ext := strings.ToLower(path.Ext(filePath)); ext != ".html" && ext != ".htm" {
+		w.Header().Set("Cache-Control", "max-age=3600, must-revalidate")
+	}
+
+	http.ServeFile(w, r, filePath)
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDist creates a static files directory holding files, keyed by their
+// slash-separated path, and returns it.
+func writeDist(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dist := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dist, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dist
+}
+
+// serveDist dispatches req to a server with no controllers serving dist.
+func serveDist(dist string, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	getHandler(struct{}{}, dist)(w, req)
+	return w
+}
+
+func TestStrictStatic(t *testing.T) {
+	dist := writeDist(t, map[string]string{
+		"docs/index.html": "docs index",
+		"docs/page.html":  "page",
+	})
+	t.Cleanup(func() { SetStrictStatic(false) })
+
+	tests := []struct {
+		strict bool
+		path   string
+		status int
+	}{
+		{false, "/docs/missing/deep", http.StatusOK}, // falls back to docs/index.html
+		{true, "/docs/missing/deep", http.StatusNotFound},
+		{true, "/docs/page.html", http.StatusOK},
+		{true, "/docs", http.StatusOK}, // the directory's own index
+	}
+
+	for _, tt := range tests {
+		SetStrictStatic(tt.strict)
+		w := serveDist(dist, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("strict %v, GET %s: got %d, want %d", tt.strict, tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+func TestStaticTraversalRejected(t *testing.T) {
+	root := t.TempDir()
+	dist := filepath.Join(root, "dist")
+
+	if err := os.MkdirAll(filepath.Join(dist, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dist, "sub", "index.html"), []byte("public"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/../secret.txt",
+		"/sub/../../secret.txt",
+		"/..%2fsecret.txt",
+		"/sub/..%2f..%2fsecret.txt",
+		"/%2e%2e/secret.txt",
+	} {
+		w := serveDist(dist, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("GET %s: got %d %q, want 404", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+type docsController struct{}
+
+func (docsController) PageGet(s *Session) (string, error) {
+	return "from handler", nil
+}
+
+func (docsController) OtherGet(s *Session) (string, error) {
+	return "from handler", nil
+}
+
+type docsRoot struct {
+	Docs docsController `controller:"true" public:"true"`
+}
+
+func TestStaticFirst(t *testing.T) {
+	dist := writeDist(t, map[string]string{"Docs/Page": "from file"})
+	t.Cleanup(func() { SetStaticFirst() })
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		getHandler(docsRoot{}, dist)(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Body.String()
+	}
+
+	if body := get("/Docs/Page"); !strings.Contains(body, "from handler") {
+		t.Errorf("default: body %q, want the handler first", body)
+	}
+
+	SetStaticFirst("/Docs")
+
+	if body := get("/Docs/Page"); body != "from file" {
+		t.Errorf("static first: body %q, want the file", body)
+	}
+	if body := get("/Docs/Other"); !strings.Contains(body, "from handler") {
+		t.Errorf("static first, no file: body %q, want the handler", body)
+	}
+}
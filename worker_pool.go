@@ -0,0 +1,109 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattia-cabrini/go-utility"
+)
+
+// WorkerPoolConfig describes a bounded pool for expensive handlers.
+type WorkerPoolConfig struct {
+	Size         int           // handlers of the pool running at once
+	QueueSize    int           // requests waiting for a slot; any more get 503 at once
+	QueueTimeout time.Duration // how long a request waits for a slot; 0 waits as long as the client
+}
+
+type workerPool struct {
+	cfg     WorkerPoolConfig
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+var workerPoolsLock = &sync.RWMutex{}
+var workerPools = make(map[string]*workerPool)
+
+// SetWorkerPool registers the pool name with cfg, replacing any previous one;
+// requests already holding a slot of the old pool keep it. A Size <= 0
+// removes the pool.
+//
+// Handlers are assigned to a pool by the pool tag of their controller field,
+// applying to every handler of the controller, or of a marker field named
+// after the route, which takes precedence:
+//
+//	Reports ReportsController `controller:"true" pool:"reports"`
+//	ExportPool struct{} `pool:"reports"`
+//
+// A request is only admitted to its pool after session, CSRF and login
+// checks, and holds its slot until the response is written, or until its
+// handler returns if it timed out (see Timeouts.Handler). When the queue is
+// full, or the slot does not free up within QueueTimeout, the request gets
+// 503 Service Unavailable.
+func SetWorkerPool(name string, cfg WorkerPoolConfig) {
+	defer utility.Monitor(workerPoolsLock)()
+
+	if cfg.Size <= 0 {
+		delete(workerPools, name)
+		return
+	}
+
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+
+	workerPools[name] = &workerPool{cfg: cfg, slots: make(chan struct{}, cfg.Size)}
+}
+
+func getWorkerPool(name string) *workerPool {
+	defer utility.RMonitor(workerPoolsLock)()
+	return workerPools[name]
+}
+
+// routePool returns the pool declared for the handlers of request by a marker
+// field, or "".
+func routePool(controller interface{}, request string) string {
+	return propertyTag(controller, request+"Pool", "pool")
+}
+
+// acquire takes a slot of the pool, waiting in the queue if there is room.
+// It returns the function releasing the slot, or false if none was obtained
+// before the timeout or the end of ctx.
+func (p *workerPool) acquire(ctx context.Context) (func(), bool) {
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, true
+	default:
+	}
+
+	if p.waiting.Add(1) > int64(p.cfg.QueueSize) {
+		p.waiting.Add(-1)
+		return nil, false
+	}
+	defer p.waiting.Add(-1)
+
+	var timeout <-chan time.Time
+
+	if p.cfg.QueueTimeout > 0 {
+		t := time.NewTimer(p.cfg.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, true
+	case <-timeout:
+	case <-ctx.Done():
+	}
+
+	return nil, false
+}
+
+func (p *workerPool) release() {
+	<-p.slots
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2025 Mattia Cabrini
+// SPDX-License-Identifier: MIT
+
+package goapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type pooledController struct {
+	running, peak *atomic.Int64
+	block         chan struct{}
+}
+
+func (c pooledController) WorkGet(s *Session) (string, error) {
+	n := c.running.Add(1)
+	defer c.running.Add(-1)
+
+	for {
+		if p := c.peak.Load(); n <= p || c.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+
+	if c.block != nil {
+		<-c.block
+	} else {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return "done", nil
+}
+
+type pooledRoot struct {
+	Jobs pooledController `controller:"true" public:"true" pool:"test"`
+}
+
+func newPooledRoot() pooledRoot {
+	return pooledRoot{Jobs: pooledController{running: &atomic.Int64{}, peak: &atomic.Int64{}}}
+}
+
+func TestWorkerPoolCapsConcurrency(t *testing.T) {
+	SetWorkerPool("test", WorkerPoolConfig{Size: 2, QueueSize: 10})
+	t.Cleanup(func() { SetWorkerPool("test", WorkerPoolConfig{}) })
+
+	root := newPooledRoot()
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := serve(root, httptest.NewRequest(http.MethodGet, "/Jobs/Work", nil)); w.Code != http.StatusOK {
+				t.Errorf("status %d, want 200", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := root.Jobs.peak.Load(); peak > 2 {
+		t.Errorf("%d handlers ran at once, want at most 2", peak)
+	}
+}
+
+func TestWorkerPoolFullQueue(t *testing.T) {
+	SetWorkerPool("test", WorkerPoolConfig{Size: 1})
+	t.Cleanup(func() { SetWorkerPool("test", WorkerPoolConfig{}) })
+
+	root := newPooledRoot()
+	root.Jobs.block = make(chan struct{})
+
+	first := make(chan int)
+	go func() {
+		first <- serve(root, httptest.NewRequest(http.MethodGet, "/Jobs/Work", nil)).Code
+	}()
+
+	for root.Jobs.running.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if w := serve(root, httptest.NewRequest(http.MethodGet, "/Jobs/Work", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("pool busy: status %d, want 503", w.Code)
+	}
+
+	close(root.Jobs.block)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first request: status %d, want 200", code)
+	}
+}